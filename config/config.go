@@ -7,36 +7,144 @@ package config
 import "os"
 
 type Data struct {
-	Debug                  bool              `yaml:"Debug"`
-	LogFile                string            `yaml:"LogFile"`
-	AWSID                  string            `yaml:"AWSID"`
-	AWSKey                 string            `yaml:"AWSKey"`
-	AWSRegion              string            `yaml:"AWSRegion"`
-	AWSQueueName           string            `yaml:"AWSQueueName"`
-	AddEC2Tags             bool              `yaml:"AddEC2Tags"`
-	Hostname               string            `yaml:"Hostname"`
-	SyslogUDP              string            `yaml:"SyslogUDP"`
-	SyslogUDPMax           int               `yaml:"SyslogUDPMax"`
-	SyslogFullMessage      bool              `yaml:"SyslogFullMessage"`
-	SyslogOverrideTime     bool              `yaml:"SyslogOverrideTime"`
-	SyslogOverrideSourceIP string            `yaml:"SyslogOverrideSourceIP"`
-	SyslogReplaceLocalhost bool              `yaml:"SyslogReplaceLocalhost"`
-	EventBuffer            int               `yaml:"EventBuffer"`
-	InputFiles             []InputFileDef    `yaml:"InputFiles"`
-	AddFields              map[string]string `yaml:"AddFields"`
-	CustomParsers          []CustomParser    `yaml:"CustomParsers,omitempty"`
+	Debug                    bool              `yaml:"Debug"`
+	LogFile                  string            `yaml:"LogFile"`
+	AWSID                    string            `yaml:"AWSID"`
+	AWSKey                   string            `yaml:"AWSKey"`
+	AWSRegion                string            `yaml:"AWSRegion"`
+	AWSQueueName             string            `yaml:"AWSQueueName"`
+	AddEC2Tags               bool              `yaml:"AddEC2Tags"`
+	Hostname                 string            `yaml:"Hostname"`
+	SyslogUDP                string            `yaml:"SyslogUDP"`
+	SyslogUDPMax             int               `yaml:"SyslogUDPMax"`
+	SyslogFullMessage        bool              `yaml:"SyslogFullMessage"`
+	SyslogOverrideTime       bool              `yaml:"SyslogOverrideTime"`
+	SyslogOverrideSourceIP   string            `yaml:"SyslogOverrideSourceIP"`
+	SyslogReplaceLocalhost   bool              `yaml:"SyslogReplaceLocalhost"`
+	SyslogStructuredDataRaw  bool              `yaml:"SyslogStructuredDataRaw"`
+	SyslogTimezone           string            `yaml:"SyslogTimezone"`
+	SyslogTimeWindow         int               `yaml:"SyslogTimeWindow"`
+	SyslogTimePolicy         string            `yaml:"SyslogTimePolicy"`
+	SyslogSources            []SyslogSourceDef `yaml:"SyslogSources,omitempty"`
+	EventBuffer              int               `yaml:"EventBuffer"`
+	EventBufferPolicy        string            `yaml:"EventBufferPolicy"`
+	EventBufferTimeout       int               `yaml:"EventBufferTimeout"`
+	EventBufferPriority      bool              `yaml:"EventBufferPriority"`
+	EventBufferReserved      int               `yaml:"EventBufferReserved"`
+	EventBufferReservedLevel int               `yaml:"EventBufferReservedLevel"`
+	Output                   string            `yaml:"Output"`
+	SenderWorkers            int               `yaml:"SenderWorkers"`
+	SQSBatchSize             int               `yaml:"SQSBatchSize"`
+	RetryMinDelay            int               `yaml:"RetryMinDelay"`
+	RetryMaxDelay            int               `yaml:"RetryMaxDelay"`
+	CircuitBreakerFailures   int               `yaml:"CircuitBreakerFailures"`
+	CircuitBreakerCooldown   int               `yaml:"CircuitBreakerCooldown"`
+	AuditdFlushTimeout       int               `yaml:"AuditdFlushTimeout"`
+	AutoSampleLines          int               `yaml:"AutoSampleLines"`
+	DeadLetterDir            string            `yaml:"DeadLetterDir"`
+	DeadLetterQueueName      string            `yaml:"DeadLetterQueueName"`
+	HTTPOutput               HTTPOutputDef     `yaml:"HTTPOutput,omitempty"`
+	InputFiles               []InputFileDef    `yaml:"InputFiles"`
+	AddFields                map[string]string `yaml:"AddFields"`
+	CustomParsers            []CustomParser    `yaml:"CustomParsers,omitempty"`
+	Processors               []ProcessorDef    `yaml:"Processors,omitempty"`
+	Filters                  []FilterDef       `yaml:"Filters,omitempty"`
+}
+
+// HTTPOutputDef describes an HTTP collector that events are posted to instead of SQS
+type HTTPOutputDef struct {
+	URL         string            `yaml:"URL"`                   // URL to POST batches to
+	Format      string            `yaml:"Format"`                // body format: json, elasticsearch or loki
+	Headers     map[string]string `yaml:"Headers,omitempty"`     // additional HTTP headers
+	Username    string            `yaml:"Username,omitempty"`    // basic authentication username
+	Password    string            `yaml:"Password,omitempty"`    // basic authentication password
+	BearerToken string            `yaml:"BearerToken,omitempty"` // bearer token (takes precedence over basic authentication)
+	Gzip        bool              `yaml:"Gzip,omitempty"`        // if true, compress the request body
+	BatchSize   int               `yaml:"BatchSize,omitempty"`   // maximum number of events per request
+	BatchWait   int               `yaml:"BatchWait,omitempty"`   // milliseconds to wait for a batch to fill
+	Timeout     int               `yaml:"Timeout,omitempty"`     // request timeout in seconds
+	Index       string            `yaml:"Index,omitempty"`       // Elasticsearch index name
+	LokiLabels  []string          `yaml:"LokiLabels,omitempty"`  // GELF fields to use as Loki stream labels
 }
 
 type InputFileDef struct {
-	Name    string `yaml:"Name"`
-	Type    string `yaml:"Type"`
-	ReadAll bool   `yaml:"-"`
+	Name     string      `yaml:"Name"`
+	Type     string      `yaml:"Type"`
+	Fallback []string    `yaml:"Fallback,omitempty"` // formats tried in turn if Type fails, followed by text
+	Timezone string      `yaml:"Timezone,omitempty"` // IANA time zone of dates without a zone, UTC by default
+	Filters  []FilterDef `yaml:"Filters,omitempty"`  // filters applied to events from the file after the global filters
+	ReadAll  bool        `yaml:"-"`
+}
+
+// SyslogSourceDef describes settings for syslog messages from a sender
+type SyslogSourceDef struct {
+	Source   string      `yaml:"Source"`             // IP address or CIDR of the sender
+	Timezone string      `yaml:"Timezone,omitempty"` // IANA time zone of RFC3164 timestamps from the sender
+	Filters  []FilterDef `yaml:"Filters,omitempty"`  // filters applied to events from the sender after the global filters
+}
+
+// ProcessorDef describes a stage of the processing pipeline that every event passes through
+type ProcessorDef struct {
+	Type      string            `yaml:"Type"`                // add, set_if_missing, rename, copy, remove, lowercase, split, convert, template or redact
+	Fields    []string          `yaml:"Fields,omitempty"`    // fields for remove, lowercase, split, convert and redact
+	Values    map[string]string `yaml:"Values,omitempty"`    // field values for add and set_if_missing, or source and target fields for rename and copy
+	Target    string            `yaml:"Target,omitempty"`    // field set by template
+	Targets   []string          `yaml:"Targets,omitempty"`   // fields set by split, <field>_1, <field>_2, etc. by default
+	Separator string            `yaml:"Separator,omitempty"` // separator for split, comma by default
+	FieldType string            `yaml:"FieldType,omitempty"` // type for convert, such as int, float, bool or ip
+	OnError   string            `yaml:"OnError,omitempty"`   // drop or raw if convert fails
+	Template  string            `yaml:"Template,omitempty"`  // Go template for template, with fields as {{._app_name}}
+	Detectors []string          `yaml:"Detectors,omitempty"` // built-in detectors for redact, such as email, card, ip, jwt, aws_key and bearer
+	Patterns  []string          `yaml:"Patterns,omitempty"`  // custom regexes for redact, which redact the first group if there is one
+	Mode      string            `yaml:"Mode,omitempty"`      // mask (the default), hash or partial for redact
+	Mask      string            `yaml:"Mask,omitempty"`      // replacement for mask, [REDACTED] by default
+	Salt      string            `yaml:"Salt,omitempty"`      // salt for hash
+	If        *ConditionDef     `yaml:"If,omitempty"`        // the stage only applies to events that match the condition
+}
+
+// ConditionDef is a condition on the fields of an event. All the tests that are set must match.
+type ConditionDef struct {
+	Field       string         `yaml:"Field,omitempty"`       // field to test
+	Equals      string         `yaml:"Equals,omitempty"`      // the field has this value
+	Regex       string         `yaml:"Regex,omitempty"`       // the field matches this regex
+	CIDR        string         `yaml:"CIDR,omitempty"`        // the field is an IP address in this network (an address or CIDR)
+	GreaterThan *float64       `yaml:"GreaterThan,omitempty"` // the field is a number greater than this
+	LessThan    *float64       `yaml:"LessThan,omitempty"`    // the field is a number less than this
+	Exists      *bool          `yaml:"Exists,omitempty"`      // the field exists (true) or is missing (false); true if no other test is set
+	Level       string         `yaml:"Level,omitempty"`       // the level is this or more severe, such as warning or 4
+	All         []ConditionDef `yaml:"All,omitempty"`         // all of these conditions match
+	Any         []ConditionDef `yaml:"Any,omitempty"`         // at least one of these conditions matches
+	Not         *ConditionDef  `yaml:"Not,omitempty"`         // this condition does not match
+}
+
+// FilterDef describes a rule that discards events
+type FilterDef struct {
+	Name   string        `yaml:"Name,omitempty"`   // name used to report discarded events
+	Action string        `yaml:"Action,omitempty"` // drop events that match (the default) or keep only events that match
+	If     *ConditionDef `yaml:"If"`               // condition on the fields of the event
 }
 
 type CustomParser struct {
-	Name        string      `yaml:"Name"`
-	Type        string      `yaml:"Type"`
-	RegexFields RegexFields `yaml:"RegexFields,omitempty"`
+	Name              string                `yaml:"Name"`
+	Type              string                `yaml:"Type"`
+	RegexFields       RegexFields           `yaml:"RegexFields,omitempty"`
+	LogFormat         string                `yaml:"LogFormat,omitempty"`         // format string for apache_logformat and nginx_logformat parsers
+	Regex             string                `yaml:"Regex,omitempty"`             // regex with named groups for namedregex parsers
+	Pattern           string                `yaml:"Pattern,omitempty"`           // expression for grok parsers
+	Patterns          map[string]string     `yaml:"Patterns,omitempty"`          // additional grok patterns
+	PatternsDir       string                `yaml:"PatternsDir,omitempty"`       // directory containing grok pattern files
+	Fields            map[string]RegexField `yaml:"Fields,omitempty"`            // field definitions for named groups, or overrides for those generated by grok
+	MessageKeys       []string              `yaml:"MessageKeys,omitempty"`       // keys that may contain the message for json parsers
+	LevelKeys         []string              `yaml:"LevelKeys,omitempty"`         // keys that may contain the level for json parsers
+	TimestampKeys     []string              `yaml:"TimestampKeys,omitempty"`     // keys that may contain the timestamp for json parsers
+	Separator         string                `yaml:"Separator,omitempty"`         // separator for flattened nested keys in json parsers
+	PairSeparator     string                `yaml:"PairSeparator,omitempty"`     // separator between pairs for logfmt parsers (whitespace by default)
+	KeyValueDelimiter string                `yaml:"KeyValueDelimiter,omitempty"` // delimiter between keys and values for logfmt parsers (= by default)
+	Delimiter         string                `yaml:"Delimiter,omitempty"`         // column delimiter for delimited parsers (, by default)
+	Columns           []string              `yaml:"Columns,omitempty"`           // column names for delimited parsers, replaced by #Fields header lines
+	Unset             string                `yaml:"Unset,omitempty"`             // marker for a column without a value in delimited parsers, such as -
+	HeaderRow         bool                  `yaml:"HeaderRow,omitempty"`         // if true, the first row of a delimited log contains the column names
+	DisableQuotes     bool                  `yaml:"DisableQuotes,omitempty"`     // if true, quotes in delimited logs are not treated specially
 }
 
 // RegexFields is a collection of RegexFields
@@ -50,6 +158,7 @@ type RegexField struct {
 	ShortMessage bool   `yaml:"ShortMessage,omitempty"` // if true, the Field will be used as the short_message in addition to the named Field
 	DateFormat   string `yaml:"DateFormat,omitempty"`   // if the Field is a date, this is the format to use for parsing
 	AddTZ        bool   `yaml:"AddTZ,omitempty"`        // if true, add the +0000 timezone to the timestamp to deal with annoying Apache logs
+	OnError      string `yaml:"OnError,omitempty"`      // drop, raw or fail if the value can not be converted to the type
 }
 
 var Config Data
@@ -74,5 +183,26 @@ func SetDefaults() {
 	Config.SyslogFullMessage = false
 	Config.SyslogOverrideTime = false
 	Config.SyslogReplaceLocalhost = false
+	Config.SyslogStructuredDataRaw = false
+	Config.SyslogTimeWindow = 240
+	Config.SyslogTimePolicy = "replace"
 	Config.EventBuffer = 4096
+	Config.EventBufferPolicy = "drop-oldest"
+	Config.EventBufferTimeout = 30
+	Config.EventBufferPriority = false
+	Config.EventBufferReserved = 0
+	Config.EventBufferReservedLevel = 2 // crit
+	Config.Output = "sqs"
+	Config.SenderWorkers = 1
+	Config.SQSBatchSize = 10
+	Config.RetryMinDelay = 1
+	Config.RetryMaxDelay = 60
+	Config.CircuitBreakerFailures = 5
+	Config.CircuitBreakerCooldown = 60
+	Config.AuditdFlushTimeout = 2
+	Config.AutoSampleLines = 20
+	Config.HTTPOutput.Format = "json"
+	Config.HTTPOutput.BatchSize = 100
+	Config.HTTPOutput.BatchWait = 1000
+	Config.HTTPOutput.Timeout = 30
 }
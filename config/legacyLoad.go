@@ -115,15 +115,16 @@ func LoadLegacy(filename string) error {
 	return nil
 }
 
-// ParseInputFile converts the string into a filename and type
+// ParseInputFile converts the string into a filename, type and optional fallback types
 func ParseInputFile(value string) (InputFileDef, error) {
 	var f InputFileDef
 	s := strings.Split(value, ",")
-	if len(s) != 2 {
-		return f, errors.New("must have two elements (path and type)")
+	if len(s) < 2 {
+		return f, errors.New("must have at least two elements (path and type)")
 	}
 	f.Name = s[0]
 	f.Type = s[1]
+	f.Fallback = s[2:]
 	f.ReadAll = false
 	return f, nil
 }
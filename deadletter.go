@@ -0,0 +1,292 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/event"
+	"log2sqs/global"
+	"log2sqs/parse"
+	"log2sqs/process"
+	"log2sqs/syslog"
+)
+
+// deadLetterCommand implements "log2sqs deadletter list|replay [-config file] [-dryrun]"
+// and returns the process exit code
+func deadLetterCommand(args []string) int {
+	if len(args) < 1 || (args[0] != "list" && args[0] != "replay") {
+		fmt.Println("usage: log2sqs deadletter list|replay [-config file] [-dryrun]")
+		return 2
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("deadletter", flag.ExitOnError)
+	cF := fs.String("config", "log2sqs.yaml", "configuration file")
+	dR := fs.Bool("dryrun", false, "dry run (print replayed events instead of sending them)")
+	_ = fs.Parse(args[1:])
+	dryRun = *dR
+
+	err := config.Load(*cF)
+	if err != nil {
+		log.Printf("Error loading configuration: %s", err.Error())
+		return 1
+	}
+
+	// Add field to report application name and version
+	config.Config.AddFields["_via_app"] = global.ProductName + " " + global.ProductVersion
+
+	// Custom parsers are required to re-parse raw lines
+	err = parse.AddCustomParsers()
+	if err != nil {
+		log.Printf("Error adding custom parsers: %s", err.Error())
+	}
+
+	// Processors and filters are applied to replayed events
+	err = process.Load()
+	if err != nil {
+		log.Printf("Error loading processors: %s", err.Error())
+		return 1
+	}
+
+	err = event.CheckOutput()
+	if err != nil {
+		log.Printf("Invalid output configuration: %s", err.Error())
+		return 1
+	}
+
+	// Connect to the output and dead-letter queue
+	if action == "replay" || config.Config.DeadLetterQueueName != "" {
+		event.Start()
+	}
+
+	if config.Config.DeadLetterQueueName != "" {
+		return deadLetterQueue(action)
+	}
+	return deadLetterDir(action)
+}
+
+// deadLetterDir lists or replays the records in the dead-letter directory
+func deadLetterDir(action string) int {
+	files, err := event.DeadLetterFiles()
+	if err != nil {
+		log.Printf("Error reading dead-letter directory: %s", err.Error())
+		return 1
+	}
+
+	count := 0
+	failed := 0
+	for _, name := range files {
+
+		// Move the file aside so that events that fail again are written to a new file. A file
+		// that is already aside was left by a replay that stopped, and is replayed again.
+		if action == "replay" && !dryRun && !strings.HasSuffix(name, ".replay") {
+			err := os.Rename(name, name+".replay")
+			if err != nil {
+				log.Printf("Error moving %s: %s", name, err.Error())
+				return 1
+			}
+			name = name + ".replay"
+		}
+
+		records, err := readDeadLetterFile(name)
+		if err != nil {
+			log.Printf("Error reading %s: %s", name, err.Error())
+			return 1
+		}
+
+		var retained []event.DeadLetterRecord
+		for _, r := range records {
+			count++
+			if action == "list" {
+				printDeadLetter(r)
+				continue
+			}
+
+			err := replayDeadLetter(r)
+			if err != nil {
+				log.Printf("Replay failed: %s [%s %s]", err.Error(), r.Source, r.Format)
+				r.Error = err.Error()
+				retained = append(retained, r)
+				failed++
+			}
+		}
+
+		if action == "replay" && !dryRun {
+			// Store anything that failed again and remove the old file
+			if len(retained) > 0 {
+				event.StoreDeadLetters(retained)
+			}
+			_ = os.Remove(name)
+		}
+	}
+
+	log.Printf("%d dead-letter records processed, %d failed", count, failed)
+	return 0
+}
+
+// deadLetterQueue lists or replays the records in the dead-letter queue. It makes a single
+// pass over the records that were in the queue when it started. Records that are received
+// again, or were added during the run, are left in the queue.
+func deadLetterQueue(action string) int {
+
+	// Keep listed records hidden until the end of the run so that each is only seen once
+	visibility := int64(300)
+	start := time.Now()
+	seen := make(map[string]bool)
+
+	count := 0
+	failed := 0
+	for {
+		msgs, err := event.ReceiveDeadLetters(visibility)
+		if err != nil {
+			log.Printf("Error reading dead-letter queue: %s", err.Error())
+			return 1
+		}
+
+		processed := 0
+		for _, m := range msgs {
+			if seen[m.ID] || m.Sent.After(start) {
+				continue
+			}
+			seen[m.ID] = true
+			processed++
+
+			r := m.Record
+			count++
+			if action == "list" {
+				printDeadLetter(r)
+				continue
+			}
+
+			err := replayDeadLetter(r)
+			if err != nil {
+				// Leave the record in the queue, it will become visible again later
+				log.Printf("Replay failed: %s [%s %s]", err.Error(), r.Source, r.Format)
+				failed++
+				continue
+			}
+
+			if !dryRun {
+				err = event.DeleteDeadLetter(m.Handle)
+				if err != nil {
+					log.Printf("Error deleting replayed record: %s", err.Error())
+				}
+			}
+		}
+
+		// Stop when the queue is empty or only returns records that are already done
+		if processed == 0 {
+			break
+		}
+	}
+
+	log.Printf("%d dead-letter records processed, %d failed", count, failed)
+	return 0
+}
+
+// readDeadLetterFile reads the JSON records in a dead-letter file
+func readDeadLetterFile(name string) ([]event.DeadLetterRecord, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	var records []event.DeadLetterRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r event.DeadLetterRecord
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			log.Printf("Skipping invalid dead-letter record in %s: %s", name, err.Error())
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// printDeadLetter prints a summary of a record
+func printDeadLetter(r event.DeadLetterRecord) {
+	data := r.Raw
+	if len(r.Event) > 0 {
+		data = string(r.Event)
+	}
+	if len(data) > 100 {
+		data = data[:100] + "..."
+	}
+	fmt.Printf("%s [%s %s] %s\n    %s\n", r.Time, r.Source, r.Format, r.Error, data)
+}
+
+// replayDeadLetter re-parses a raw line or resends an event
+func replayDeadLetter(r event.DeadLetterRecord) error {
+	var gBytes []byte
+
+	switch {
+	case len(r.Event) > 0:
+		gBytes = r.Event
+
+	case r.Format == syslog.Format:
+		g, err := syslog.Parse([]byte(r.Raw), r.Source)
+		if errors.Is(err, process.ErrFiltered) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		gBytes, err = json.Marshal(g)
+		if err != nil {
+			return err
+		}
+
+	case r.Format != "":
+		// The format may list the formats of a chain, as recorded by Parser.Format
+		formats := strings.Split(r.Format, ",")
+		parser, err := parse.NewChain(formats[0], formats[1:])
+		if err != nil {
+			return err
+		}
+		g, err := parser.Parse(r.Raw)
+		if errors.Is(err, parse.ErrSkip) {
+			// A single record of an event that spans several lines
+			var ok bool
+			if g, ok = parser.Flush(0); ok {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+		gBytes, err = fileEvent(g, r.Source)
+		if errors.Is(err, process.ErrFiltered) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+	default:
+		return errors.New("record has no event or format")
+	}
+
+	if dryRun {
+		global.JSONPretty(gBytes)
+		return nil
+	}
+	return event.Resend(gBytes)
+}
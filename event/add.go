@@ -7,34 +7,158 @@ package event
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"log2sqs/config"
 	"log2sqs/global"
+	"log2sqs/process"
 )
 
-var discardTime int64 = 0
+// Buffer overflow policies
+const (
+	policyDropOldest = "drop-oldest"
+	policyDropNewest = "drop-newest"
+	policyBlock      = "block"
+)
+
+// Source used for events that do not come from an input
+const sourceInternal = "internal"
 
-// Add log message to internal queue (buffer) for transmission to SQS
-func Add(msg []byte) {
+// Number of events discarded per source since the last report
+var dropMX = sync.Mutex{}
+var drops = make(map[string]int)
+
+// Add log message to internal queue (buffer) for transmission to the output. The source
+// (for example, the syslog sender's IP address) is used to report discarded events, and
+// the GELF level is used to prioritize events when priority buffering is enabled.
+func Add(msg []byte, source string, level int) {
 
 	if config.Config.Debug {
-		log.Printf("Buffer contains %d log events", len(eventBuffer))
+		log.Printf("Buffer contains %d log events", eventBuffer.len())
+	}
+
+	e := bufferedEvent{msg: msg, source: source, level: level}
+	var deadline time.Time
+
+	for {
+		eventBuffer.mx.Lock()
+		ok, space := eventBuffer.push(e)
+		if ok {
+			eventBuffer.mx.Unlock()
+			return
+		}
+
+		// Events that may use the reserved capacity displace less severe events
+		// regardless of the policy
+		if eventBuffer.reserved(level) {
+			if old, ok := eventBuffer.evictBelow(level); ok {
+				_, _ = eventBuffer.push(e)
+				eventBuffer.mx.Unlock()
+				countDrop(old.source)
+				return
+			}
+		}
+
+		switch bufferPolicy() {
+
+		case policyBlock:
+			// Wait for space. This blocks the caller, so inputs that read synchronously
+			// stop reading until there is room.
+			eventBuffer.mx.Unlock()
+			if deadline.IsZero() {
+				deadline = time.Now().Add(time.Duration(config.Config.EventBufferTimeout) * time.Second)
+			}
+
+			timer := time.NewTimer(time.Until(deadline))
+			select {
+			case <-space:
+				timer.Stop()
+				continue
+			case <-timer.C:
+				countDrop(source)
+				return
+			}
+
+		case policyDropNewest:
+			eventBuffer.mx.Unlock()
+			countDrop(source)
+			return
+
+		default:
+			// Discard the oldest event that is not more severe than this one
+			old, ok := eventBuffer.evict(level)
+			if ok {
+				_, _ = eventBuffer.push(e)
+			}
+			eventBuffer.mx.Unlock()
+
+			if ok {
+				countDrop(old.source)
+			} else {
+				countDrop(source)
+			}
+			return
+		}
+	}
+}
+
+// bufferPolicy returns the configured overflow policy in lower case
+func bufferPolicy() string {
+	return strings.ToLower(config.Config.EventBufferPolicy)
+}
+
+// countDrop records a discarded event
+func countDrop(source string) {
+	if source == "" {
+		source = "unknown"
 	}
 
-	// Check if the number of items in the buffer is at the limit
-	if len(eventBuffer) >= config.Config.EventBuffer {
+	dropMX.Lock()
+	defer dropMX.Unlock()
+	drops[source]++
+}
 
-		// Discard oldest message
-		_ = <-eventBuffer
+// reportDrops logs the number of discarded events per source once per minute. This limits
+// logging to reduce flooding while the buffer is full.
+func reportDrops() {
+	for {
+		time.Sleep(60 * time.Second)
 
-		// Limit logging this event to a maximum of once per minute to reduce flooding
-		if (time.Now().Unix() - discardTime) > 60 {
-			Log(fmt.Sprintf("Buffer full (%d items), discarding oldest log event", len(eventBuffer)), "", global.ERR)
-			discardTime = time.Now().Unix()
+		dropMX.Lock()
+		total := 0
+		var counts []string
+		for source, n := range drops {
+			total += n
+			counts = append(counts, fmt.Sprintf("%s=%d", source, n))
+		}
+		drops = make(map[string]int)
+		dropMX.Unlock()
+
+		if total > 0 {
+			sort.Strings(counts)
+			Log(fmt.Sprintf("Buffer full (%s policy), discarded %d log events: %s", bufferPolicy(), total, strings.Join(counts, " ")), "", global.ERR)
 		}
 	}
+}
 
-	// Add to buffer
-	eventBuffer <- msg
+// reportFiltered logs the number of events discarded by each filter once per minute
+func reportFiltered() {
+	for {
+		time.Sleep(60 * time.Second)
+
+		total := 0
+		var counts []string
+		for name, n := range process.Filtered() {
+			total += n
+			counts = append(counts, fmt.Sprintf("%s=%d", name, n))
+		}
+
+		if total > 0 {
+			sort.Strings(counts)
+			Log(fmt.Sprintf("Filters discarded %d log events: %s", total, strings.Join(counts, " ")), "", global.INFO)
+		}
+	}
 }
@@ -0,0 +1,71 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+// circuitBreaker stops sending to an output that keeps failing. After the cooldown
+// a single trial request is allowed through; success closes the circuit again.
+type circuitBreaker struct {
+	mx        sync.Mutex
+	failures  int       // consecutive failures
+	openUntil time.Time // zero if closed
+	trial     bool      // true while a trial request is in progress
+}
+
+var breaker circuitBreaker
+
+// allow returns true if a request may be sent
+func (b *circuitBreaker) allow() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+
+	// Cooldown has elapsed, allow one trial request
+	b.trial = true
+	return true
+}
+
+// record updates the breaker with the result of a request
+func (b *circuitBreaker) record(err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	wasOpen := !b.openUntil.IsZero()
+	b.trial = false
+
+	// Throttling and rejected messages show that the endpoint is alive
+	if err == nil || classify(err) == errThrottled || classify(err) == errPermanent {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		if wasOpen {
+			go Log("Output recovered, circuit breaker closed", "", global.NOTICE)
+		}
+		return
+	}
+
+	b.failures++
+	if config.Config.CircuitBreakerFailures > 0 && b.failures >= config.Config.CircuitBreakerFailures {
+		b.openUntil = time.Now().Add(time.Duration(config.Config.CircuitBreakerCooldown) * time.Second)
+		if !wasOpen {
+			go Log(fmt.Sprintf("Output failed %d times, circuit breaker open for %d seconds: %s",
+				b.failures, config.Config.CircuitBreakerCooldown, err.Error()), "", global.ERR)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"sync"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+// Number of lanes, one per syslog level
+const numLanes = global.DEBUG + 1
+
+// bufferedEvent is a message waiting to be sent and where it came from
+type bufferedEvent struct {
+	msg    []byte
+	source string
+	level  int
+}
+
+// eventQueue holds buffered events in one lane per GELF level. When priority is disabled,
+// all events share a single lane and are delivered in order.
+type eventQueue struct {
+	mx      sync.Mutex
+	lanes   [numLanes][]bufferedEvent
+	credit  [numLanes]int // smooth weighted round-robin state
+	count   int
+	ready   chan struct{} // closed and replaced when an event is added
+	space   chan struct{} // closed and replaced when an event is removed
+	enabled bool          // priority lanes enabled
+}
+
+// newEventQueue returns an empty queue
+func newEventQueue(priority bool) *eventQueue {
+	return &eventQueue{
+		ready:   make(chan struct{}),
+		space:   make(chan struct{}),
+		enabled: priority,
+	}
+}
+
+// lane returns the lane used for a level
+func (b *eventQueue) lane(level int) int {
+	if !b.enabled {
+		return 0
+	}
+	if level < 0 {
+		return 0
+	}
+	if level >= numLanes {
+		return numLanes - 1
+	}
+	return level
+}
+
+// reserved returns true if the level may use the reserved capacity
+func (b *eventQueue) reserved(level int) bool {
+	return b.enabled && level <= config.Config.EventBufferReservedLevel
+}
+
+// limit returns the capacity available to events of the given level
+func (b *eventQueue) limit(level int) int {
+	if !b.enabled || b.reserved(level) || config.Config.EventBufferReserved <= 0 {
+		return config.Config.EventBuffer
+	}
+
+	// Always leave some room for the other levels
+	if config.Config.EventBufferReserved >= config.Config.EventBuffer {
+		return 1
+	}
+	return config.Config.EventBuffer - config.Config.EventBufferReserved
+}
+
+// len returns the number of buffered events
+func (b *eventQueue) len() int {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.count
+}
+
+// push adds an event if there is room and returns a channel that is closed when space
+// becomes available if there is not. The caller must hold the lock.
+func (b *eventQueue) push(e bufferedEvent) (bool, chan struct{}) {
+	if b.count >= b.limit(e.level) {
+		return false, b.space
+	}
+
+	l := b.lane(e.level)
+	b.lanes[l] = append(b.lanes[l], e)
+	b.count++
+
+	// Wake waiting senders
+	close(b.ready)
+	b.ready = make(chan struct{})
+	return true, nil
+}
+
+// pushFront puts events back at the head of their lanes, in order, so that they are delivered
+// next. The capacity is not checked because the events were already accepted, and waiting for
+// space would stall the senders that free it. The caller must hold the lock.
+func (b *eventQueue) pushFront(events []bufferedEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	var heads [numLanes][]bufferedEvent
+	for _, e := range events {
+		l := b.lane(e.level)
+		heads[l] = append(heads[l], e)
+	}
+	for l := range heads {
+		if len(heads[l]) > 0 {
+			b.lanes[l] = append(heads[l], b.lanes[l]...)
+		}
+	}
+	b.count += len(events)
+
+	// Wake waiting senders
+	close(b.ready)
+	b.ready = make(chan struct{})
+}
+
+// evict removes the oldest event from the least severe lane that is not more severe
+// than level. Returns false if there is no such event.
+func (b *eventQueue) evict(level int) (bufferedEvent, bool) {
+	for l := numLanes - 1; l >= b.lane(level); l-- {
+		if len(b.lanes[l]) > 0 {
+			return b.remove(l), true
+		}
+	}
+	return bufferedEvent{}, false
+}
+
+// evictBelow removes the oldest event from the least severe lane that is less severe
+// than level. This lets events using reserved capacity displace lower levels.
+func (b *eventQueue) evictBelow(level int) (bufferedEvent, bool) {
+	for l := numLanes - 1; l > b.lane(level); l-- {
+		if len(b.lanes[l]) > 0 {
+			return b.remove(l), true
+		}
+	}
+	return bufferedEvent{}, false
+}
+
+// remove takes the oldest event from a lane. The caller must hold the lock.
+func (b *eventQueue) remove(l int) bufferedEvent {
+	e := b.lanes[l][0]
+	b.lanes[l][0] = bufferedEvent{}
+	b.lanes[l] = b.lanes[l][1:]
+	b.count--
+
+	// Wake waiting producers
+	close(b.space)
+	b.space = make(chan struct{})
+	return e
+}
+
+// pop removes the next event to deliver. Lanes are served by smooth weighted round-robin,
+// each level having twice the weight of the next less severe level, so that severe events
+// drain first without starving the others. The caller must hold the lock and count > 0.
+func (b *eventQueue) pop() bufferedEvent {
+	best := -1
+	total := 0
+	for l := 0; l < numLanes; l++ {
+		if len(b.lanes[l]) == 0 {
+			continue
+		}
+		w := 1 << (numLanes - 1 - l)
+		b.credit[l] += w
+		total += w
+		if best == -1 || b.credit[l] > b.credit[best] {
+			best = l
+		}
+	}
+	b.credit[best] -= total
+	return b.remove(best)
+}
+
+// take blocks until an event is available, then returns up to max events, waiting up to
+// wait for more to arrive
+func (b *eventQueue) take(max int, wait time.Duration) []bufferedEvent {
+	var events []bufferedEvent
+	var timer *time.Timer
+
+	for {
+		b.mx.Lock()
+		for b.count > 0 && len(events) < max {
+			events = append(events, b.pop())
+		}
+		ready := b.ready
+		b.mx.Unlock()
+
+		if len(events) >= max || (len(events) > 0 && wait <= 0) {
+			break
+		}
+
+		// Wait for the first event indefinitely, then for the rest of the batch
+		if len(events) == 0 {
+			<-ready
+			continue
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		}
+
+		select {
+		case <-ready:
+		case <-timer.C:
+			return events
+		}
+	}
+	return events
+}
@@ -0,0 +1,59 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"testing"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+func TestRequeueFullBuffer(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.EventBuffer = 2
+	config.Config.EventBufferPolicy = "block"
+	config.Config.EventBufferTimeout = 30
+	eventBuffer = newEventQueue(true)
+
+	batch := []bufferedEvent{
+		{msg: []byte("retry1"), source: "file", level: global.INFO},
+		{msg: []byte("retry2"), source: "file", level: global.ERR},
+	}
+	eventBuffer.mx.Lock()
+	eventBuffer.push(bufferedEvent{msg: []byte("new1"), level: global.INFO})
+	eventBuffer.push(bufferedEvent{msg: []byte("new2"), level: global.INFO})
+	eventBuffer.mx.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		requeue(batch, []int{0, 1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("requeue blocked on a full buffer")
+	}
+
+	if n := eventBuffer.len(); n != 4 {
+		t.Fatalf("buffer has %d events, want 4", n)
+	}
+
+	// The requeued events are delivered before the newer events in their lanes
+	got := eventBuffer.take(4, 0)
+	order := ""
+	for _, e := range got {
+		order += string(e.msg) + " "
+	}
+	if order != "retry2 retry1 new1 new2 " {
+		t.Errorf("delivery order = %q", order)
+	}
+	if got[1].source != "file" {
+		t.Errorf("source = %q, want the original source", got[1].source)
+	}
+}
@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"log2sqs/config"
+	"log2sqs/process"
+)
+
+// DeadLetterRecord is stored for each event that can never be delivered or parsed
+type DeadLetterRecord struct {
+	Time   string          `json:"time"`             // time the event was dead-lettered (RFC3339)
+	Source string          `json:"source,omitempty"` // file name or syslog source
+	Format string          `json:"format,omitempty"` // parser format used for the raw line
+	Error  string          `json:"error"`            // reason the event was dead-lettered
+	Raw    string          `json:"raw,omitempty"`    // raw line that could not be parsed
+	Event  json.RawMessage `json:"event,omitempty"`  // GELF event that could not be delivered
+}
+
+// DeadLetterMessage is a record received from the dead-letter queue
+type DeadLetterMessage struct {
+	Record DeadLetterRecord
+	ID     string    // SQS message ID
+	Handle string    // receipt handle used to delete the message
+	Sent   time.Time // time the message was sent to the queue
+}
+
+var deadLetterMX = sync.Mutex{}
+
+// DeadLetterRaw stores a line that could not be parsed so that it can be replayed later. The
+// redact processors are applied to the line, as they would have been to the event.
+func DeadLetterRaw(source string, format string, raw string, reason error) {
+	StoreDeadLetters([]DeadLetterRecord{{
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Source: source,
+		Format: format,
+		Error:  reason.Error(),
+		Raw:    process.Redact(raw),
+	}})
+}
+
+// deadLetter stores events that were permanently rejected by the output so that they
+// are not retried forever
+func deadLetter(msgs [][]byte, reason error) {
+	log.Printf("Unable to deliver %d events: %s", len(msgs), reason.Error())
+
+	var records []DeadLetterRecord
+	for _, msg := range msgs {
+		r := DeadLetterRecord{Time: time.Now().UTC().Format(time.RFC3339), Error: reason.Error(), Event: msg}
+
+		// Events that are not valid JSON are stored as a string
+		if !json.Valid(msg) {
+			r.Event = nil
+			r.Raw = string(msg)
+		}
+		records = append(records, r)
+	}
+	StoreDeadLetters(records)
+}
+
+// StoreDeadLetters writes records to the dead-letter queue if configured, otherwise to the
+// dead-letter directory. Records the queue did not accept are written to the directory.
+// Records are discarded if neither is configured.
+func StoreDeadLetters(records []DeadLetterRecord) {
+	if config.Config.DeadLetterQueueName != "" {
+		unsent, err := sendDeadLetterQueue(records)
+		if err == nil {
+			return
+		}
+		log.Printf("Error sending %d of %d records to dead-letter queue: %s", len(unsent), len(records), err.Error())
+		records = unsent
+	}
+
+	if config.Config.DeadLetterDir == "" {
+		log.Printf("No dead-letter directory configured, discarding %d events", len(records))
+		return
+	}
+
+	deadLetterMX.Lock()
+	defer deadLetterMX.Unlock()
+
+	// One file per day
+	name := filepath.Join(config.Config.DeadLetterDir, "deadletter-"+time.Now().UTC().Format("2006-01-02")+".json")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Error opening dead-letter file: %s", err.Error())
+		return
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+
+	for _, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			log.Printf("Error encoding dead-letter record: %s", err.Error())
+			continue
+		}
+		_, _ = f.Write(append(b, '\n'))
+	}
+}
+
+// sendDeadLetterQueue sends records to the SQS dead-letter queue and returns the records
+// that were not sent if it fails
+func sendDeadLetterQueue(records []DeadLetterRecord) ([]DeadLetterRecord, error) {
+	q, dlqURL := conn.getDLQ()
+	if q == nil || dlqURL == "" {
+		return records, errors.New("dead-letter queue not connected")
+	}
+
+	for i, r := range records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return records[i:], err
+		}
+
+		_, err = q.SendMessage(&sqs.SendMessageInput{
+			MessageBody: aws.String(string(b)),
+			QueueUrl:    aws.String(dlqURL),
+		})
+		if err != nil {
+			return records[i:], err
+		}
+	}
+	return nil, nil
+}
+
+// DeadLetterFiles returns the dead-letter files in the dead-letter directory, oldest first.
+// Files that were being replayed when a replay stopped, renamed to *.json.replay, are
+// included so that they are not orphaned.
+func DeadLetterFiles() ([]string, error) {
+	if config.Config.DeadLetterDir == "" {
+		return nil, errors.New("no dead-letter directory configured")
+	}
+
+	var files []string
+	for _, pattern := range []string{"deadletter-*.json", "deadletter-*.json.replay"} {
+		matches, err := filepath.Glob(filepath.Join(config.Config.DeadLetterDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ReceiveDeadLetters reads up to 10 records from the dead-letter queue. The records
+// become visible again after visibility seconds unless deleted with DeleteDeadLetter.
+func ReceiveDeadLetters(visibility int64) ([]DeadLetterMessage, error) {
+	q, dlqURL := conn.getDLQ()
+	if q == nil || dlqURL == "" {
+		return nil, errors.New("dead-letter queue not connected")
+	}
+
+	out, err := q.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(dlqURL),
+		MaxNumberOfMessages: aws.Int64(10),
+		VisibilityTimeout:   aws.Int64(visibility),
+		AttributeNames:      []*string{aws.String(sqs.MessageSystemAttributeNameSentTimestamp)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []DeadLetterMessage
+	for _, m := range out.Messages {
+		var r DeadLetterRecord
+		err := json.Unmarshal([]byte(aws.StringValue(m.Body)), &r)
+		if err != nil {
+			// Not one of ours, treat the whole message as an undelivered event
+			r = DeadLetterRecord{Error: "unknown", Raw: aws.StringValue(m.Body)}
+		}
+
+		// SentTimestamp is in milliseconds since the epoch
+		var sent time.Time
+		if ms, err := strconv.ParseInt(aws.StringValue(m.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64); err == nil {
+			sent = time.UnixMilli(ms)
+		}
+
+		msgs = append(msgs, DeadLetterMessage{
+			Record: r,
+			ID:     aws.StringValue(m.MessageId),
+			Handle: aws.StringValue(m.ReceiptHandle),
+			Sent:   sent,
+		})
+	}
+	return msgs, nil
+}
+
+// DeleteDeadLetter removes a record from the dead-letter queue
+func DeleteDeadLetter(handle string) error {
+	q, dlqURL := conn.getDLQ()
+	if q == nil || dlqURL == "" {
+		return errors.New("dead-letter queue not connected")
+	}
+
+	_, err := q.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(dlqURL),
+		ReceiptHandle: aws.String(handle),
+	})
+	return err
+}
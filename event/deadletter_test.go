@@ -0,0 +1,99 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"log2sqs/config"
+)
+
+func TestDeadLetterFiles(t *testing.T) {
+	dir := t.TempDir()
+	config.Config = config.Data{}
+	config.Config.DeadLetterDir = dir
+
+	for _, name := range []string{"deadletter-2023-10-02.json", "deadletter-2023-10-01.json.replay", "deadletter-2023-10-01.json", "other.json"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := DeadLetterFiles()
+	if err != nil {
+		t.Fatalf("DeadLetterFiles: %s", err)
+	}
+	want := []string{"deadletter-2023-10-01.json", "deadletter-2023-10-01.json.replay", "deadletter-2023-10-02.json"}
+	if len(files) != len(want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	for i, f := range files {
+		if filepath.Base(f) != want[i] {
+			t.Errorf("file %d = %s, want %s", i, filepath.Base(f), want[i])
+		}
+	}
+}
+
+func TestStoreDeadLettersQueueFallback(t *testing.T) {
+	// A dead-letter queue that accepts the first record and rejects the rest
+	sent := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ MessageBody string }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		if sent > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"InvalidMessageContents","message":"rejected"}`))
+			return
+		}
+		sent++
+		sum := md5.Sum([]byte(in.MessageBody))
+		_, _ = fmt.Fprintf(w, `{"MD5OfMessageBody":"%s","MessageId":"1"}`, hex.EncodeToString(sum[:]))
+	}))
+	t.Cleanup(srv.Close)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(srv.URL),
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	conn.set(sqs.New(sess), srv.URL+"/queue", srv.URL+"/dlq")
+	t.Cleanup(func() { conn.set(nil, "", "") })
+
+	dir := t.TempDir()
+	config.Config = config.Data{}
+	config.Config.DeadLetterDir = dir
+	config.Config.DeadLetterQueueName = "dlq"
+
+	StoreDeadLetters([]DeadLetterRecord{{Error: "one", Raw: "a"}, {Error: "two", Raw: "b"}, {Error: "three", Raw: "c"}})
+
+	// Only the records the queue did not accept are written to the directory
+	files, err := DeadLetterFiles()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %v, %v", files, err)
+	}
+	b, _ := os.ReadFile(files[0])
+	if got := strings.Count(string(b), "\n"); got != 2 {
+		t.Errorf("%d records written to the directory, want 2: %s", got, b)
+	}
+	if strings.Contains(string(b), `"one"`) {
+		t.Errorf("record accepted by the queue was also written to the directory")
+	}
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Classes of send errors
+const (
+	errRetryable = iota // transient failure, retry after a delay
+	errThrottled        // the endpoint is asking us to slow down
+	errPermanent        // the message will never be accepted
+	errAuth             // credentials are missing, invalid or expired
+)
+
+// errCircuitOpen is returned instead of sending while the circuit breaker is open
+var errCircuitOpen = errors.New("circuit breaker open, output unavailable")
+
+// permanentError wraps an error that retrying can not fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// httpError is returned for unsuccessful HTTP output responses
+type httpError struct {
+	status     int
+	body       string
+	retryAfter time.Duration // delay requested with Retry-After, if any
+}
+
+func (e *httpError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("HTTP status %d", e.status)
+	}
+	return fmt.Sprintf("HTTP status %d: %s", e.status, e.body)
+}
+
+// AWS error codes that indicate the message itself was rejected
+var permanentCodes = map[string]bool{
+	sqs.ErrCodeInvalidMessageContents:       true,
+	sqs.ErrCodeBatchRequestTooLong:          true,
+	sqs.ErrCodeInvalidAttributeName:         true,
+	sqs.ErrCodeInvalidAttributeValue:        true,
+	sqs.ErrCodeUnsupportedOperation:         true,
+	sqs.ErrCodeTooManyEntriesInBatchRequest: true,
+	"InvalidParameterValue":                 true,
+	"MessageTooLong":                        true,
+	"ValidationError":                       true,
+}
+
+// AWS error codes that indicate a credential or permission problem
+var authCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"InvalidClientTokenId":        true,
+	"SignatureDoesNotMatch":       true,
+	"UnrecognizedClientException": true,
+	"MissingAuthenticationToken":  true,
+	"InvalidAccessKeyId":          true,
+	"NoCredentialProviders":       true,
+	sqs.ErrCodeInvalidSecurity:    true,
+	sqs.ErrCodeKmsAccessDenied:    true,
+}
+
+// classify determines how a send error should be handled
+func classify(err error) int {
+	var pErr *permanentError
+	if errors.As(err, &pErr) {
+		return errPermanent
+	}
+
+	var hErr *httpError
+	if errors.As(err, &hErr) {
+		switch {
+		case hErr.status == http.StatusUnauthorized || hErr.status == http.StatusForbidden:
+			return errAuth
+		case hErr.status == http.StatusTooManyRequests:
+			return errThrottled
+		case hErr.status == http.StatusRequestTimeout || hErr.status >= 500:
+			return errRetryable
+		default:
+			return errPermanent
+		}
+	}
+
+	var aErr awserr.Error
+	if errors.As(err, &aErr) {
+		switch {
+		case request.IsErrorThrottle(err) || aErr.Code() == sqs.ErrCodeKmsThrottled:
+			return errThrottled
+		case request.IsErrorExpiredCreds(err) || authCodes[aErr.Code()]:
+			return errAuth
+		case permanentCodes[aErr.Code()]:
+			return errPermanent
+		}
+	}
+
+	return errRetryable
+}
+
+// RetryDelay returns the delay the output asked for before a retry, such as an HTTP
+// Retry-After, or 0 if it did not ask for one
+func RetryDelay(err error) time.Duration {
+	var hErr *httpError
+	if errors.As(err, &hErr) {
+		return hErr.retryAfter
+	}
+	return 0
+}
+
+// className returns a description of the error class for logging
+func className(class int) string {
+	switch class {
+	case errThrottled:
+		return "throttled"
+	case errPermanent:
+		return "permanent"
+	case errAuth:
+		return "auth"
+	default:
+		return "retryable"
+	}
+}
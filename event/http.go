@@ -0,0 +1,329 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// HTTP output body formats
+const (
+	httpFormatJSON          = "json"
+	httpFormatElasticsearch = "elasticsearch"
+	httpFormatLoki          = "loki"
+)
+
+var httpClient *http.Client
+
+// Largest response body read, which must hold an Elasticsearch bulk response
+const httpMaxResponseBytes = 16 * 1024 * 1024
+
+// Characters that are not permitted in Loki label names
+var lokiLabelRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// httpFormat returns the configured body format in lower case
+func httpFormat() string {
+	return strings.ToLower(config.Config.HTTPOutput.Format)
+}
+
+// openHTTP prepares the HTTP client
+func openHTTP() {
+	httpClient = &http.Client{Timeout: time.Duration(config.Config.HTTPOutput.Timeout) * time.Second}
+	log.Printf("HTTP output to %s (%s) ready", config.Config.HTTPOutput.URL, config.Config.HTTPOutput.Format)
+}
+
+// deliverHTTP posts a batch of events to the HTTP collector and returns the indices of the
+// events that were not delivered. Events the collector rejects are passed to reject.
+func deliverHTTP(msgs [][]byte, reject func(msgs [][]byte, reason error)) ([]int, error) {
+	unsent, err := sendHTTP(msgs, reject)
+	if err == nil || classify(err) != errPermanent {
+		return unsent, err
+	}
+	if len(msgs) == 1 {
+		reject(msgs, err)
+		return nil, nil
+	}
+
+	// A rejected batch may contain a single bad event, so send them individually to avoid
+	// dead-lettering the others. Stop if the collector fails for another reason.
+	unsent = nil
+	var lastErr error
+	for i := range msgs {
+		failed, err := deliverHTTP(msgs[i:i+1], reject)
+		if err == nil {
+			continue
+		}
+		lastErr = err
+		if len(failed) > 0 {
+			unsent = append(unsent, i)
+		}
+		if classify(err) != errPermanent {
+			unsent = append(unsent, indices(i+1, len(msgs))...)
+			break
+		}
+	}
+	return unsent, lastErr
+}
+
+// sendHTTP posts a batch of events to the HTTP collector in a single request and returns the
+// indices of the events that were not delivered. Retries are left to the caller.
+func sendHTTP(msgs [][]byte, reject func(msgs [][]byte, reason error)) ([]int, error) {
+
+	body, contentType, err := httpBody(msgs)
+	if err != nil {
+		// The events can not be encoded, so retrying will not help
+		return indices(0, len(msgs)), &permanentError{err: err}
+	}
+
+	// Compress if required
+	if config.Config.HTTPOutput.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+		body = buf.Bytes()
+	}
+
+	respBody, err := postHTTP(body, contentType)
+	if err != nil {
+		return indices(0, len(msgs)), err
+	}
+
+	// Elasticsearch reports per-document failures in a successful response
+	if httpFormat() == httpFormatElasticsearch && bytes.Contains(respBody, []byte(`"errors":true`)) {
+		return bulkErrors(msgs, respBody, reject)
+	}
+	return nil, nil
+}
+
+// bulkItem is the result of one action in an Elasticsearch bulk response
+type bulkItem struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// bulkErrors passes the documents that Elasticsearch rejected to reject and returns the
+// indices of those that failed because it was overloaded, so that they are retried
+func bulkErrors(msgs [][]byte, respBody []byte, reject func(msgs [][]byte, reason error)) ([]int, error) {
+	var resp struct {
+		Items []map[string]bulkItem `json:"items"`
+	}
+	err := json.Unmarshal(respBody, &resp)
+	if err != nil || len(resp.Items) != len(msgs) {
+		log.Printf("Unable to match Elasticsearch bulk response to %d events: %s", len(msgs), truncate(string(respBody)))
+		return nil, nil
+	}
+
+	var unsent []int
+	var lastErr *httpError
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+
+			itemErr := &httpError{status: result.Status, body: string(result.Error)}
+			if classify(itemErr) == errPermanent {
+				reject(msgs[i:i+1], itemErr)
+				continue
+			}
+			unsent = append(unsent, i)
+			lastErr = itemErr
+		}
+	}
+
+	if len(unsent) > 0 {
+		lastErr.body = fmt.Sprintf("%d of %d documents failed: %s", len(unsent), len(msgs), lastErr.body)
+		return unsent, lastErr
+	}
+	return nil, nil
+}
+
+// postHTTP makes a single request and returns the body of a successful response
+func postHTTP(body []byte, contentType string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, config.Config.HTTPOutput.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, &permanentError{err: err}
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", global.ProductName+"/"+global.ProductVersion)
+	if config.Config.HTTPOutput.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for key, value := range config.Config.HTTPOutput.Headers {
+		req.Header.Set(key, value)
+	}
+
+	// Add authentication
+	if config.Config.HTTPOutput.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Config.HTTPOutput.BearerToken)
+	} else if config.Config.HTTPOutput.Username != "" {
+		req.SetBasicAuth(config.Config.HTTPOutput.Username, config.Config.HTTPOutput.Password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, httpMaxResponseBytes))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return respBody, nil
+	}
+
+	return nil, &httpError{
+		status:     resp.StatusCode,
+		body:       truncate(strings.TrimSpace(string(respBody))),
+		retryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// truncate shortens a response body for logging
+func truncate(s string) string {
+	if len(s) > 4096 {
+		return s[:4096] + "..."
+	}
+	return s
+}
+
+// retryAfter converts a Retry-After header (seconds or HTTP date) to a duration
+func retryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second
+	}
+
+	if t, err := http.ParseTime(s); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+// httpBody builds the request body for the configured format
+func httpBody(msgs [][]byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch httpFormat() {
+
+	case httpFormatJSON:
+		for _, msg := range msgs {
+			buf.Write(msg)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+
+	case httpFormatElasticsearch:
+		action, _ := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": config.Config.HTTPOutput.Index}})
+		for _, msg := range msgs {
+			buf.Write(action)
+			buf.WriteByte('\n')
+			buf.Write(msg)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+
+	case httpFormatLoki:
+		b, err := lokiBody(msgs)
+		return b, "application/json", err
+
+	default:
+		return nil, "", fmt.Errorf("unknown HTTP output format %s", config.Config.HTTPOutput.Format)
+	}
+}
+
+// lokiStream is a single stream in a Loki push request
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiBody groups events into streams by their label values
+func lokiBody(msgs [][]byte) ([]byte, error) {
+	streams := make(map[string]*lokiStream)
+	var keys []string
+
+	for _, msg := range msgs {
+		g := parse.GELFMessage{}
+		err := json.Unmarshal(msg, &g)
+		if err != nil {
+			return nil, err
+		}
+
+		// Build the label set from the configured GELF fields
+		labels := make(map[string]string)
+		for _, field := range config.Config.HTTPOutput.LokiLabels {
+			if v, ok := g[field]; ok {
+				labels[lokiLabelRegex.ReplaceAllString(strings.TrimPrefix(field, "_"), "_")] = fmt.Sprint(v)
+			}
+		}
+
+		// Loki requires at least one label
+		if len(labels) == 0 {
+			labels["job"] = global.ProductName
+		}
+
+		key := lokiKey(labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: labels}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+
+		// Timestamp is a string containing nanoseconds since the epoch. GELF timestamps have
+		// microsecond precision, so round to avoid floating point noise in the last digits.
+		ts := time.Now().UnixNano()
+		if f, ok := g["timestamp"].(float64); ok {
+			ts = int64(math.Round(f*1e6)) * 1000
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(ts, 10), string(msg)})
+	}
+
+	push := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		push.Streams = append(push.Streams, streams[key])
+	}
+
+	return json.Marshal(push)
+}
+
+// lokiKey returns a stable key for a label set
+func lokiKey(labels map[string]string) string {
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	key := ""
+	for _, name := range names {
+		key = key + name + "=" + labels[name] + ","
+	}
+	return key
+}
@@ -0,0 +1,396 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"log2sqs/config"
+)
+
+// collector is a test HTTP collector that records requests and replies with the queued responses
+type collector struct {
+	mx       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	replies  []reply
+}
+
+// reply is a queued response
+type reply struct {
+	status  int
+	headers map[string]string
+	body    string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, body)
+
+	resp := reply{status: http.StatusOK}
+	if len(c.replies) > 0 {
+		resp = c.replies[0]
+		c.replies = c.replies[1:]
+	}
+	for k, v := range resp.headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write([]byte(resp.body))
+}
+
+// reply queues a response
+func (c *collector) reply(status int, headers map[string]string, body string) {
+	c.replies = append(c.replies, reply{status: status, headers: headers, body: body})
+}
+
+// rejected records the events passed to reject
+type rejected struct {
+	msgs    [][]byte
+	reasons []error
+}
+
+func (r *rejected) reject(msgs [][]byte, reason error) {
+	r.msgs = append(r.msgs, msgs...)
+	r.reasons = append(r.reasons, reason)
+}
+
+// startCollector starts a test collector and configures the HTTP output to use it
+func startCollector(t *testing.T, format string) *collector {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.Output = outputHTTP
+	config.Config.HTTPOutput.URL = srv.URL
+	config.Config.HTTPOutput.Format = format
+	httpClient = &http.Client{Timeout: 5 * time.Second}
+	return c
+}
+
+var testEvents = [][]byte{
+	[]byte(`{"version":"1.1","host":"web1","short_message":"one","timestamp":1697000000.123456,"_app_name":"nginx"}`),
+	[]byte(`{"version":"1.1","host":"web2","short_message":"two","timestamp":1697000001,"_app_name":"nginx"}`),
+}
+
+func TestHTTPBodyJSON(t *testing.T) {
+	c := startCollector(t, httpFormatJSON)
+
+	if _, err := deliverHTTP(testEvents, deadLetter); err != nil {
+		t.Fatalf("deliverHTTP: %s", err)
+	}
+
+	want := string(testEvents[0]) + "\n" + string(testEvents[1]) + "\n"
+	if got := string(c.bodies[0]); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if ct := c.requests[0].Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestHTTPBodyElasticsearch(t *testing.T) {
+	c := startCollector(t, httpFormatElasticsearch)
+	config.Config.HTTPOutput.Index = "graylog"
+
+	if _, err := deliverHTTP(testEvents, deadLetter); err != nil {
+		t.Fatalf("deliverHTTP: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(c.bodies[0]), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4: %q", len(lines), c.bodies[0])
+	}
+	for i, line := range lines {
+		if i%2 == 0 {
+			if line != `{"index":{"_index":"graylog"}}` {
+				t.Errorf("line %d = %q, want index action", i, line)
+			}
+		} else if line != string(testEvents[i/2]) {
+			t.Errorf("line %d = %q, want %q", i, line, testEvents[i/2])
+		}
+	}
+}
+
+func TestHTTPBodyLoki(t *testing.T) {
+	c := startCollector(t, httpFormatLoki)
+	config.Config.HTTPOutput.LokiLabels = []string{"host", "_app_name"}
+
+	if _, err := deliverHTTP(testEvents, deadLetter); err != nil {
+		t.Fatalf("deliverHTTP: %s", err)
+	}
+
+	var push struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	if err := json.Unmarshal(c.bodies[0], &push); err != nil {
+		t.Fatalf("invalid push body: %s", err)
+	}
+	if len(push.Streams) != 2 {
+		t.Fatalf("got %d streams, want 2", len(push.Streams))
+	}
+
+	s := push.Streams[0]
+	if s.Stream["host"] != "web1" || s.Stream["app_name"] != "nginx" {
+		t.Errorf("labels = %v", s.Stream)
+	}
+	if len(s.Values) != 1 || s.Values[0][0] != "1697000000123456000" || s.Values[0][1] != string(testEvents[0]) {
+		t.Errorf("values = %v", s.Values)
+	}
+	if ct := c.requests[0].Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestHTTPLokiDefaultLabel(t *testing.T) {
+	c := startCollector(t, httpFormatLoki)
+
+	if _, err := deliverHTTP(testEvents[:1], deadLetter); err != nil {
+		t.Fatalf("deliverHTTP: %s", err)
+	}
+	if !bytes.Contains(c.bodies[0], []byte(`"stream":{"job":"log2sqs"}`)) {
+		t.Errorf("body has no default job label: %s", c.bodies[0])
+	}
+}
+
+func TestHTTPAuthHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		token    string
+		want     string
+	}{
+		{name: "basic", user: "user", password: "secret", want: "Basic dXNlcjpzZWNyZXQ="},
+		{name: "bearer", token: "abc123", want: "Bearer abc123"},
+		{name: "bearer over basic", user: "user", password: "secret", token: "abc123", want: "Bearer abc123"},
+		{name: "none", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startCollector(t, httpFormatJSON)
+			config.Config.HTTPOutput.Username = tt.user
+			config.Config.HTTPOutput.Password = tt.password
+			config.Config.HTTPOutput.BearerToken = tt.token
+			config.Config.HTTPOutput.Headers = map[string]string{"X-Scope-OrgID": "tenant1"}
+
+			if _, err := deliverHTTP(testEvents, deadLetter); err != nil {
+				t.Fatalf("deliverHTTP: %s", err)
+			}
+			r := c.requests[0]
+			if got := r.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("Authorization = %q, want %q", got, tt.want)
+			}
+			if got := r.Header.Get("X-Scope-OrgID"); got != "tenant1" {
+				t.Errorf("X-Scope-OrgID = %q", got)
+			}
+		})
+	}
+}
+
+func TestHTTPGzip(t *testing.T) {
+	c := startCollector(t, httpFormatJSON)
+	config.Config.HTTPOutput.Gzip = true
+
+	if _, err := deliverHTTP(testEvents, deadLetter); err != nil {
+		t.Fatalf("deliverHTTP: %s", err)
+	}
+	if got := c.requests[0].Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q", got)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(c.bodies[0]))
+	if err != nil {
+		t.Fatalf("body is not gzip: %s", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !bytes.HasPrefix(body, testEvents[0]) {
+		t.Errorf("decompressed body = %q", body)
+	}
+}
+
+func TestHTTPRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		class   int
+		delay   time.Duration
+	}{
+		{name: "429 with Retry-After", status: http.StatusTooManyRequests, headers: map[string]string{"Retry-After": "1"}, class: errThrottled, delay: time.Second},
+		{name: "503", status: http.StatusServiceUnavailable, class: errRetryable},
+		{name: "408", status: http.StatusRequestTimeout, class: errRetryable},
+		{name: "500 with Retry-After", status: http.StatusInternalServerError, headers: map[string]string{"Retry-After": "1"}, class: errRetryable, delay: time.Second},
+		{name: "401", status: http.StatusUnauthorized, class: errAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startCollector(t, httpFormatJSON)
+			c.reply(tt.status, tt.headers, "")
+			r := &rejected{}
+
+			// The request is made once, and the caller retries every event after the delay
+			unsent, err := deliverHTTP(testEvents, r.reject)
+			if classify(err) != tt.class {
+				t.Errorf("class = %s, want %s", className(classify(err)), className(tt.class))
+			}
+			if len(unsent) != len(testEvents) || len(r.msgs) != 0 {
+				t.Errorf("unsent = %v, rejected %d, want all unsent", unsent, len(r.msgs))
+			}
+			if len(c.requests) != 1 {
+				t.Errorf("got %d requests, want 1", len(c.requests))
+			}
+			if got := RetryDelay(err); got != tt.delay {
+				t.Errorf("RetryDelay = %s, want %s", got, tt.delay)
+			}
+		})
+	}
+}
+
+func TestHTTPPermanent(t *testing.T) {
+	c := startCollector(t, httpFormatJSON)
+	c.reply(http.StatusBadRequest, nil, "bad event")
+	c.reply(http.StatusBadRequest, nil, "bad event")
+	r := &rejected{}
+
+	// Only the event the collector rejects on its own is dead-lettered
+	unsent, err := deliverHTTP(testEvents, r.reject)
+	if err != nil || len(unsent) != 0 {
+		t.Fatalf("deliverHTTP = %v, %v", unsent, err)
+	}
+	if len(c.requests) != 3 {
+		t.Errorf("got %d requests, want 3", len(c.requests))
+	}
+	if len(r.msgs) != 1 || string(r.msgs[0]) != string(testEvents[0]) {
+		t.Errorf("rejected %q, want the first event", r.msgs)
+	}
+	if string(c.bodies[2]) != string(testEvents[1])+"\n" {
+		t.Errorf("last request = %q, want the second event", c.bodies[2])
+	}
+}
+
+func TestHTTPPermanentThenRetryable(t *testing.T) {
+	c := startCollector(t, httpFormatJSON)
+	c.reply(http.StatusBadRequest, nil, "")
+	c.reply(http.StatusServiceUnavailable, nil, "")
+	r := &rejected{}
+
+	// The individual sends stop when the collector fails, leaving every event to retry
+	unsent, err := deliverHTTP(testEvents, r.reject)
+	if classify(err) != errRetryable {
+		t.Errorf("class = %s, want retryable", className(classify(err)))
+	}
+	if len(unsent) != 2 || len(r.msgs) != 0 || len(c.requests) != 2 {
+		t.Errorf("unsent = %v, rejected %d, requests %d", unsent, len(r.msgs), len(c.requests))
+	}
+}
+
+func TestHTTPBulkErrors(t *testing.T) {
+	c := startCollector(t, httpFormatElasticsearch)
+	config.Config.HTTPOutput.Index = "graylog"
+	c.reply(http.StatusOK, nil, `{"took":3,"errors":true,"items":[
+		{"index":{"_index":"graylog","status":201}},
+		{"index":{"_index":"graylog","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}},
+		{"index":{"_index":"graylog","status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`)
+	r := &rejected{}
+
+	msgs := append(append([][]byte{}, testEvents...), []byte(`{"version":"1.1","host":"web3","short_message":"three"}`))
+	unsent, err := deliverHTTP(msgs, r.reject)
+	if classify(err) != errThrottled {
+		t.Errorf("class = %s, want throttled", className(classify(err)))
+	}
+	if len(unsent) != 1 || unsent[0] != 2 {
+		t.Errorf("unsent = %v, want [2]", unsent)
+	}
+	if len(r.msgs) != 1 || string(r.msgs[0]) != string(msgs[1]) {
+		t.Errorf("rejected %q, want the second event", r.msgs)
+	}
+	if len(r.reasons) == 1 && !strings.Contains(r.reasons[0].Error(), "mapper_parsing_exception") {
+		t.Errorf("reason = %s", r.reasons[0])
+	}
+}
+
+func TestHTTPBulkSuccess(t *testing.T) {
+	c := startCollector(t, httpFormatElasticsearch)
+	c.reply(http.StatusOK, nil, `{"took":3,"errors":false,"items":[{"index":{"status":201}},{"index":{"status":201}}]}`)
+	r := &rejected{}
+
+	unsent, err := deliverHTTP(testEvents, r.reject)
+	if err != nil || len(unsent) != 0 || len(r.msgs) != 0 {
+		t.Errorf("deliverHTTP = %v, %v, rejected %d", unsent, err, len(r.msgs))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter("5"); got != 5*time.Second {
+		t.Errorf("retryAfter(5) = %s", got)
+	}
+	if got := retryAfter(""); got != 0 {
+		t.Errorf("retryAfter('') = %s", got)
+	}
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := retryAfter(date); got <= 0 || got > 10*time.Second {
+		t.Errorf("retryAfter(%s) = %s", date, got)
+	}
+}
+
+func TestHTTPFormatCase(t *testing.T) {
+	c := startCollector(t, "Loki")
+
+	if _, err := deliverHTTP(testEvents, deadLetter); err != nil {
+		t.Fatalf("deliverHTTP: %s", err)
+	}
+	if !bytes.HasPrefix(c.bodies[0], []byte(`{"streams":`)) {
+		t.Errorf("body = %s, want a Loki push", c.bodies[0])
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		url    string
+		format string
+		valid  bool
+	}{
+		{output: "sqs", valid: true},
+		{output: "SQS", valid: true},
+		{output: "kafka"},
+		{output: "http", url: "http://localhost:3100", format: "json", valid: true},
+		{output: "HTTP", url: "http://localhost:3100", format: "Elasticsearch", valid: true},
+		{output: "http", url: "http://localhost:3100", format: "Loki", valid: true},
+		{output: "http", url: "http://localhost:3100", format: "lokki"},
+		{output: "http", format: "json"},
+	}
+
+	for _, tt := range tests {
+		config.Config = config.Data{}
+		config.SetDefaults()
+		config.Config.Output = tt.output
+		config.Config.HTTPOutput.URL = tt.url
+		config.Config.HTTPOutput.Format = tt.format
+
+		err := CheckOutput()
+		if (err == nil) != tt.valid {
+			t.Errorf("CheckOutput(%s, %q, %s) = %v, want valid %t", tt.output, tt.url, tt.format, err, tt.valid)
+		}
+	}
+}
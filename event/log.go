@@ -11,6 +11,7 @@ import (
 	"log2sqs/config"
 	"log2sqs/global"
 	"log2sqs/parse"
+	"log2sqs/process"
 )
 
 // Log reports significant internal event through GELF message
@@ -31,17 +32,8 @@ func Log(message string, full string, level int) {
 	g["_via_hostname"] = config.Config.Hostname
 	g["_via_proto"] = "gelf"
 
-	// Add source IP
-	if config.Config.SyslogOverrideSourceIP != "" {
-		g["_event_source_ip"] = config.Config.SyslogOverrideSourceIP
-	} else {
-		g["_event_source_ip"] = global.GetOutboundIP()
-	}
-
-	// Add any static fields
-	for key, value := range config.Config.AddFields {
-		g[key] = value
-	}
+	// Add source IP and static fields, and apply the processors
+	_ = process.Apply(g, process.Input{Internal: true})
 
 	// Marshal JSON for queue
 	gBytes, err := json.Marshal(g)
@@ -55,5 +47,5 @@ func Log(message string, full string, level int) {
 	}
 
 	// Add to memory buffer
-	Add(gBytes)
+	Add(gBytes, sourceInternal, level)
 }
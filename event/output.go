@@ -0,0 +1,147 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package event
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+)
+
+// Output types
+const (
+	outputSQS  = "sqs"
+	outputHTTP = "http"
+)
+
+// outputType returns the configured output in lower case
+func outputType() string {
+	return strings.ToLower(config.Config.Output)
+}
+
+// CheckOutput checks that the output type and, for the HTTP output, its URL and format are valid
+func CheckOutput() error {
+	switch outputType() {
+	case outputSQS:
+		return nil
+	case outputHTTP:
+	default:
+		return errors.New(fmt.Sprintf("unknown output type %s", config.Config.Output))
+	}
+
+	if config.Config.HTTPOutput.URL == "" {
+		return errors.New("HTTPOutput URL cannot be empty")
+	}
+	switch httpFormat() {
+	case httpFormatJSON, httpFormatElasticsearch, httpFormatLoki:
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("unknown HTTPOutput format %s", config.Config.HTTPOutput.Format))
+	}
+}
+
+// deliver sends a batch of messages to the configured output once and returns the indices
+// of the messages that were not delivered, which the caller retries after a delay. Messages that can never
+// be delivered are passed to reject, which is deadLetter except when replaying dead-lettered
+// events.
+func deliver(msgs [][]byte, reject func(msgs [][]byte, reason error)) ([]int, error) {
+	if !breaker.allow() {
+		return indices(0, len(msgs)), errCircuitOpen
+	}
+
+	var unsent []int
+	var err error
+	if outputType() == outputHTTP {
+		unsent, err = deliverHTTP(msgs, reject)
+	} else {
+		unsent, err = deliverSQS(msgs, reject)
+	}
+	breaker.record(err)
+	return unsent, err
+}
+
+// deliverSQS splits messages into requests that fit within the SQS batch size limit
+func deliverSQS(msgs [][]byte, reject func(msgs [][]byte, reason error)) ([]int, error) {
+	var unsent []int
+	var lastErr error
+
+	send := func(start int, end int) {
+		failed, err := sendSQSBatch(msgs[start:end], reject)
+		if err == nil {
+			return
+		}
+
+		// A rejected batch may contain a single bad message, so retry them
+		// individually to avoid dead-lettering the others
+		if classify(err) == errPermanent && end-start > 1 {
+			for i := start; i < end; i++ {
+				_, err := sendSQSBatch(msgs[i:i+1], reject)
+				if err != nil {
+					unsent = append(unsent, i)
+					lastErr = err
+				}
+			}
+			return
+		}
+
+		for _, i := range failed {
+			unsent = append(unsent, start+i)
+		}
+		lastErr = err
+	}
+
+	start := 0
+	size := 0
+	for i, msg := range msgs {
+		if i > start && size+len(msg) > sqsMaxBatchBytes {
+			send(start, i)
+			start = i
+			size = 0
+		}
+		size += len(msg)
+	}
+	send(start, len(msgs))
+
+	return unsent, lastErr
+}
+
+// indices returns the indices from start up to, but not including, end
+func indices(start int, end int) []int {
+	var list []int
+	for i := start; i < end; i++ {
+		list = append(list, i)
+	}
+	return list
+}
+
+// batchSize returns the maximum number of messages to deliver at once
+func batchSize() int {
+	if outputType() == outputHTTP {
+		if config.Config.HTTPOutput.BatchSize > 1 {
+			return config.Config.HTTPOutput.BatchSize
+		}
+		return 1
+	}
+
+	if config.Config.SQSBatchSize > sqsMaxBatch {
+		return sqsMaxBatch
+	}
+	if config.Config.SQSBatchSize < 1 {
+		return 1
+	}
+	return config.Config.SQSBatchSize
+}
+
+// batchWait returns the time to wait for a batch to fill. SQS batches are sent with
+// whatever is already buffered.
+func batchWait() time.Duration {
+	if outputType() == outputHTTP {
+		return time.Duration(config.Config.HTTPOutput.BatchWait) * time.Millisecond
+	}
+	return 0
+}
@@ -12,21 +12,20 @@ import (
 	"log2sqs/global"
 )
 
-// Buffered channel to queue events to be sent to SQS
-var eventBuffer chan []byte
+// Buffer to queue events to be sent to the output
+var eventBuffer *eventQueue
 
 // initQueue creates the queue
 func initQueue() {
-	// Create buffer with a bit of extra space to avoid blocking
-	eventBuffer = make(chan []byte, config.Config.EventBuffer+10)
+	eventBuffer = newEventQueue(config.Config.EventBufferPriority)
 }
 
-// runQueue reads the internal event buffer channel and writes to SQS
-func runQueue() {
+// watchBuffer periodically reports when the buffer crosses the warning thresholds
+func watchBuffer() {
 	bufferWarning := false
 
 	for {
-		bPercent := float64(len(eventBuffer)) / float64(config.Config.EventBuffer)
+		bPercent := float64(eventBuffer.len()) / float64(config.Config.EventBuffer)
 
 		if bufferWarning {
 			if bPercent < 0.6 {
@@ -40,21 +39,66 @@ func runQueue() {
 			}
 		}
 
+		time.Sleep(1 * time.Second)
+	}
+}
+
+// runQueue reads the internal event buffer channel and writes to the output.
+// Several may run concurrently, each sending its own batches.
+func runQueue(worker int) {
+	b := global.NewBackoff(time.Duration(config.Config.RetryMinDelay)*time.Second, time.Duration(config.Config.RetryMaxDelay)*time.Second)
+
+	for {
 		// This is blocking, which is fine
-		msg := <-eventBuffer
+		batch := nextBatch()
+		msgs := make([][]byte, len(batch))
+		for i, e := range batch {
+			msgs[i] = e.msg
+		}
 
-		// Send to SQS
-		err := sendSQS(msg)
+		// Send to output
+		unsent, err := deliver(msgs, deadLetter)
 		if err != nil {
-			// Log error
-			log.Printf("Error sending buffered syslog message to SQS: %s", err.Error())
+			// Log error unless we are simply waiting for the circuit breaker
+			if err != errCircuitOpen {
+				log.Printf("Sender %d: error (%s) sending %d of %d buffered log events: %s", worker, className(classify(err)), len(unsent), len(msgs), err.Error())
+			}
 
-			// Add the message back into the buffer to prevent loss
-			Add(msg)
+			// Add the messages back into the buffer to prevent loss
+			requeue(batch, unsent)
 
-			// Wait 15 seconds before trying again
-			log.Printf("Sleeping for 15 seconds...")
-			time.Sleep(15 * time.Second)
+			// Wait before trying again, as long as the output asked if it did
+			wait := RetryDelay(err)
+			if wait > 0 {
+				wait = b.Limit(wait)
+			} else {
+				wait = b.Next()
+			}
+			if config.Config.Debug {
+				log.Printf("Sender %d: sleeping for %s...", worker, wait.Round(time.Millisecond))
+			}
+			time.Sleep(wait)
+		} else {
+			b.Reset()
 		}
 	}
 }
+
+// nextBatch blocks until a message is available, then collects up to batchSize() messages
+// or until the batch wait time has elapsed
+func nextBatch() []bufferedEvent {
+	return eventBuffer.take(batchSize(), batchWait())
+}
+
+// requeue puts the undelivered events of a batch, given by their indices, back at the head of
+// the buffer, bypassing the overflow policy so that a full buffer can not block or discard them
+func requeue(batch []bufferedEvent, unsent []int) {
+	var events []bufferedEvent
+	for _, i := range unsent {
+		events = append(events, batch[i])
+	}
+
+	eventBuffer.mx.Lock()
+	eventBuffer.pushFront(events)
+	eventBuffer.mx.Unlock()
+}
@@ -4,8 +4,23 @@
 
 package event
 
-// Send is a public function to send directly via SQS without buffering
+// Send is a public function to send directly to the output without buffering
 // This is useful for log files where buffering in memory doesn't make sense
 func Send(msg []byte) error {
-	return sendSQS(msg)
+	_, err := deliver([][]byte{msg}, deadLetter)
+	return err
+}
+
+// Resend sends directly to the output like Send, but returns an error instead of
+// dead-lettering the message if the output rejects it. This is used to replay
+// dead-lettered events without adding them to the dead-letter store again.
+func Resend(msg []byte) error {
+	var rejected error
+	_, err := deliver([][]byte{msg}, func(_ [][]byte, reason error) {
+		rejected = reason
+	})
+	if err == nil {
+		err = rejected
+	}
+	return err
 }
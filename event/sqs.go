@@ -8,7 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -17,10 +19,48 @@ import (
 	"github.com/aws/aws-sdk-go/service/sqs"
 
 	"log2sqs/config"
+	"log2sqs/global"
 )
 
-var q *sqs.SQS
-var qURL = ""
+// Maximum number of messages and total payload size accepted by SendMessageBatch
+const (
+	sqsMaxBatch      = 10
+	sqsMaxBatchBytes = 256 * 1024
+)
+
+// sqsConnection holds the SQS client and queue URL shared by all senders. watchSQS
+// replaces both on reconnection, so access is guarded by a mutex.
+type sqsConnection struct {
+	mx     sync.RWMutex
+	q      *sqs.SQS
+	url    string
+	dlqURL string
+}
+
+var conn sqsConnection
+
+// get returns the current client and queue URL
+func (c *sqsConnection) get() (*sqs.SQS, string) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.q, c.url
+}
+
+// getDLQ returns the current client and dead-letter queue URL
+func (c *sqsConnection) getDLQ() (*sqs.SQS, string) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.q, c.dlqURL
+}
+
+// set replaces the client and queue URLs
+func (c *sqsConnection) set(q *sqs.SQS, url string, dlqURL string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.q = q
+	c.url = url
+	c.dlqURL = dlqURL
+}
 
 // Buffered channel to trigger SQS reconnection
 var sqsRestart = make(chan int, 1024)
@@ -28,12 +68,14 @@ var sqsRestart = make(chan int, 1024)
 // Open the SQS queue. Block until success because there is no point reading logs if
 // there is nowhere to send them.
 func openSQS() {
+	b := global.NewBackoff(time.Duration(config.Config.RetryMinDelay)*time.Second, time.Duration(config.Config.RetryMaxDelay)*time.Second)
 	for {
 		err := connectSQS()
 		if err != nil {
+			wait := b.Next()
 			log.Printf("Error opening queue: %s", err.Error())
-			log.Printf("Sleeping for 30 seconds...")
-			time.Sleep(30 * time.Second)
+			log.Printf("Sleeping for %s...", wait.Round(time.Second))
+			time.Sleep(wait)
 		} else {
 			log.Printf("SQS queue %s opened", config.Config.AWSQueueName)
 			return
@@ -61,7 +103,7 @@ func connectSQS() error {
 	}
 
 	awsSession := session.Must(session.NewSession(awsConfig))
-	q = sqs.New(awsSession)
+	q := sqs.New(awsSession)
 	if q == nil {
 		return errors.New("unable to create new AWS Session")
 	}
@@ -74,26 +116,53 @@ func connectSQS() error {
 		return errors.New(tmp)
 	}
 
-	// Search for requested queue name
-	for _, t := range listQueueResults.QueueUrls {
-		if strings.Contains(*t, config.Config.AWSQueueName) {
-			qURL = *t
-			break
+	// Search for requested queue names. The output queue is not required when
+	// SQS is only used for dead letters.
+	qURL := ""
+	if outputType() != outputHTTP {
+		qURL = findQueue(listQueueResults.QueueUrls, config.Config.AWSQueueName)
+		if qURL == "" {
+			tmp := fmt.Sprintf("unable to find SQS queue %s", config.Config.AWSQueueName)
+			return errors.New(tmp)
 		}
 	}
 
-	if qURL == "" {
-		tmp := fmt.Sprintf("unable to find SQS queue %s", config.Config.AWSQueueName)
-		return errors.New(tmp)
+	dlqURL := ""
+	if config.Config.DeadLetterQueueName != "" {
+		dlqURL = findQueue(listQueueResults.QueueUrls, config.Config.DeadLetterQueueName)
+		if dlqURL == "" {
+			tmp := fmt.Sprintf("unable to find SQS dead-letter queue %s", config.Config.DeadLetterQueueName)
+			return errors.New(tmp)
+		}
 	}
 
+	conn.set(q, qURL, dlqURL)
 	return nil
 }
 
-func sendSQS(msg []byte) error {
+// findQueue returns the URL of the named queue, preferring an exact match so that a
+// dead-letter queue such as "graylog-deadletter" is not mistaken for "graylog"
+func findQueue(urls []*string, name string) string {
+	for _, t := range urls {
+		if strings.HasSuffix(*t, "/"+name) {
+			return *t
+		}
+	}
+
+	for _, t := range urls {
+		if strings.Contains(*t, name) {
+			return *t
+		}
+	}
+	return ""
+}
+
+func sendSQS(msg []byte, reject func(msgs [][]byte, reason error)) error {
 
 	//global.JSONPretty(msg) // For debugging only
 
+	q, qURL := conn.get()
+
 	// Set up parameters
 	var sendParams *sqs.SendMessageInput
 	sendParams = &sqs.SendMessageInput{
@@ -104,14 +173,85 @@ func sendSQS(msg []byte) error {
 	// Send to SQS
 	_, err := q.SendMessage(sendParams)
 	if err != nil {
-		// Request reconnection
-		sqsRestart <- 1
+		requestReconnect(err)
+		if classify(err) == errPermanent {
+			reject([][]byte{msg}, err)
+			return nil
+		}
 		return err
 	}
 
 	return nil
 }
 
+// requestReconnect asks watchSQS to reconnect if the error suggests the connection,
+// credentials or queue URL are no longer valid. Throttling and rejected messages
+// do not require a new connection.
+func requestReconnect(err error) {
+	class := classify(err)
+	if class == errRetryable || class == errAuth {
+		sqsRestart <- 1
+	}
+}
+
+// sendSQSBatch sends up to sqsMaxBatch messages in a single request and returns the
+// indices of the messages that were not accepted. Messages that SQS rejected are passed
+// to reject.
+func sendSQSBatch(msgs [][]byte, reject func(msgs [][]byte, reason error)) ([]int, error) {
+	if len(msgs) == 1 {
+		// sendSQS handles a rejected message
+		err := sendSQS(msgs[0], reject)
+		if err != nil {
+			return []int{0}, err
+		}
+		return nil, nil
+	}
+
+	q, qURL := conn.get()
+
+	// Build the batch, using the index as the entry ID
+	var entries []*sqs.SendMessageBatchRequestEntry
+	for i, msg := range msgs {
+		entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(string(msg)),
+		})
+	}
+
+	out, err := q.SendMessageBatch(&sqs.SendMessageBatchInput{
+		Entries:  entries,
+		QueueUrl: aws.String(qURL),
+	})
+	if err != nil {
+		requestReconnect(err)
+		return indices(0, len(msgs)), err
+	}
+
+	// Dead-letter messages SQS rejected and return the others for a retry
+	var failed []int
+	var lastErr error
+	for _, f := range out.Failed {
+		i, err := strconv.Atoi(aws.StringValue(f.Id))
+		if err != nil || i < 0 || i >= len(msgs) {
+			continue
+		}
+
+		entryErr := fmt.Errorf("%s: %s", aws.StringValue(f.Code), aws.StringValue(f.Message))
+		if aws.BoolValue(f.SenderFault) {
+			reject([][]byte{msgs[i]}, entryErr)
+			continue
+		}
+
+		failed = append(failed, i)
+		lastErr = entryErr
+	}
+
+	if len(failed) > 0 {
+		return failed, fmt.Errorf("%d of %d messages failed: %s", len(failed), len(msgs), lastErr.Error())
+	}
+	return nil, nil
+}
+
 // watchSQS waits for reconnection attempts and actions them
 func watchSQS() {
 	for {
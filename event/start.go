@@ -4,16 +4,35 @@
 
 package event
 
-// Start initializes queues (internal and SQS) and starts the reading process
+import "log2sqs/config"
+
+// Start initializes queues (internal and output) and starts the reading process
 func Start() {
 
 	// Initialize the queue
 	initQueue()
 
+	if outputType() == outputHTTP {
+		// Prepare the HTTP client
+		openHTTP()
+	}
+
 	// Connect to SQS and block if required
-	openSQS()
+	if outputType() != outputHTTP || config.Config.DeadLetterQueueName != "" {
+		openSQS()
+		go watchSQS()
+	}
 
 	// Start goroutines
-	go watchSQS()
-	go runQueue()
+	go watchBuffer()
+	go reportDrops()
+	go reportFiltered()
+
+	workers := config.Config.SenderWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 1; i <= workers; i++ {
+		go runQueue(i)
+	}
 }
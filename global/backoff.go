@@ -0,0 +1,55 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package global
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff calculates retry delays that double after each failure up to a maximum.
+// Half of each delay is randomized so that many senders do not retry in lockstep.
+type Backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+// NewBackoff returns a Backoff with the given minimum and maximum delays
+func NewBackoff(min time.Duration, max time.Duration) *Backoff {
+	if min <= 0 {
+		min = time.Second
+	}
+	if max < min {
+		max = min
+	}
+	return &Backoff{min: min, max: max}
+}
+
+// Next returns the delay before the next attempt
+func (b *Backoff) Next() time.Duration {
+	d := b.max
+	if b.attempt < 32 && b.min<<b.attempt < b.max {
+		d = b.min << b.attempt
+		b.attempt++
+	}
+
+	// Equal jitter: wait at least half the delay
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Limit returns d, or the maximum delay if d is longer
+func (b *Backoff) Limit(d time.Duration) time.Duration {
+	if d > b.max {
+		return b.max
+	}
+	return d
+}
+
+// Reset returns the delay to the minimum after a success
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
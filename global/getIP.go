@@ -5,8 +5,10 @@
 package global
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 )
 
 // GetOutboundIP uses net.Dial to determine the hosts preferred IP address
@@ -22,3 +24,22 @@ func GetOutboundIP() string {
 
 	return fmt.Sprint(conn.LocalAddr().(*net.UDPAddr).IP)
 }
+
+// ParseNetwork converts an IP address or CIDR to a network
+func ParseNetwork(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("invalid IP address")
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(s)
+	return network, err
+}
@@ -106,6 +106,12 @@ func GetFacility(fac int) string {
 	return "unknown"
 }
 
+// TimeStamp returns the current time as a GELF timestamp
 func TimeStamp() float64 {
-	return float64(time.Now().UnixMilli()) / 1000.0
+	return UnixTime(time.Now())
+}
+
+// UnixTime returns a GELF timestamp, the seconds since the epoch with decimals for microseconds
+func UnixTime(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
 }
@@ -12,11 +12,13 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"log2sqs/config"
 	"log2sqs/event"
 	"log2sqs/global"
 	"log2sqs/parse"
+	"log2sqs/process"
 	"log2sqs/syslog"
 )
 
@@ -31,6 +33,11 @@ func main() {
 	// File to ingest for testing
 	var ingest = ""
 
+	// Dead-letter maintenance command
+	if len(os.Args) > 1 && os.Args[1] == "deadletter" {
+		os.Exit(deadLetterCommand(os.Args[2:]))
+	}
+
 	// Command line arguments
 	// Check for path to config file as only argument for backward compatibility
 	if len(os.Args) == 2 {
@@ -74,6 +81,12 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	// Check for a valid output before connecting to it
+	err = event.CheckOutput()
+	if err != nil {
+		log.Fatalf("Invalid output configuration: %s", err.Error())
+	}
+
 	// Add field to report application name and version
 	config.Config.AddFields["_via_app"] = global.ProductName + " " + global.ProductVersion
 
@@ -98,6 +111,12 @@ func main() {
 		log.Printf("Error adding custom parsers: %s", err.Error())
 	}
 
+	// Compile the processing pipeline
+	err = process.Load()
+	if err != nil {
+		log.Fatalf("Error loading processors: %s", err.Error())
+	}
+
 	// Retrieve EC2 addFields if necessary
 	if config.Config.AddEC2Tags {
 		ec2Tags()
@@ -126,11 +145,28 @@ func main() {
 		// Force all file types to lower case
 		inputFile.Type = strings.ToLower(inputFile.Type)
 
-		// Check for valid file type
-		if parse.CheckFormat(inputFile.Type) == false {
+		// Check for valid file type and fallback types
+		valid := parse.CheckFormat(inputFile.Type)
+		if valid == false {
 			event.Log(fmt.Sprintf("Unknown input file type: %s %s", inputFile.Name, inputFile.Type), "", global.INFO)
-		} else {
-			// Launch a goroutine to handle this file
+		}
+		for i, fallback := range inputFile.Fallback {
+			inputFile.Fallback[i] = strings.ToLower(fallback)
+			if inputFile.Fallback[i] == "auto" || parse.CheckFormat(inputFile.Fallback[i]) == false {
+				event.Log(fmt.Sprintf("Unknown fallback type: %s %s", inputFile.Name, fallback), "", global.INFO)
+				valid = false
+			}
+		}
+
+		if inputFile.Timezone != "" {
+			if _, err := time.LoadLocation(inputFile.Timezone); err != nil {
+				event.Log(fmt.Sprintf("Unknown time zone: %s %s", inputFile.Name, inputFile.Timezone), "", global.INFO)
+				valid = false
+			}
+		}
+
+		// Launch a goroutine to handle this file
+		if valid {
 			go tailFile(inputFile)
 		}
 	}
@@ -6,6 +6,8 @@ package parse
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 
 	"log2sqs/config"
@@ -15,6 +17,12 @@ import (
 func AddCustomParsers() error {
 	for _, p := range config.Config.CustomParsers {
 
+		// Check field types now rather than converting unknown types to strings
+		err := checkFields(p)
+		if err != nil {
+			return errors.New(fmt.Sprintf("parser %s: %s", p.Name, err.Error()))
+		}
+
 		// Check type of custom parser
 		switch strings.ToLower(p.Type) {
 		case "regex":
@@ -22,6 +30,53 @@ func AddCustomParsers() error {
 			if err != nil {
 				return err
 			}
+		case "apache_logformat":
+			fields, err := CompileApacheLogFormat(p.LogFormat)
+			if err != nil {
+				return errors.New(fmt.Sprintf("parser %s: %s", p.Name, err.Error()))
+			}
+			err = AddRegexParser(p.Name, fields)
+			if err != nil {
+				return err
+			}
+		case "nginx_logformat":
+			fields, err := CompileNginxLogFormat(p.LogFormat)
+			if err != nil {
+				return errors.New(fmt.Sprintf("parser %s: %s", p.Name, err.Error()))
+			}
+			err = AddRegexParser(p.Name, fields)
+			if err != nil {
+				return err
+			}
+		case "namedregex":
+			err := AddNamedRegexParser(p.Name, p.Regex, namedFields(p.Fields))
+			if err != nil {
+				return errors.New(fmt.Sprintf("parser %s: %s", p.Name, err.Error()))
+			}
+		case "json":
+			err := addKeyParser(p.Name, JSONParserType, newKeyOptions(p))
+			if err != nil {
+				return err
+			}
+		case "logfmt", "kv":
+			err := addKeyParser(p.Name, LogfmtParserType, newKeyOptions(p))
+			if err != nil {
+				return err
+			}
+		case "delimited":
+			o, err := newDelimitedOptions(p)
+			if err != nil {
+				return errors.New(fmt.Sprintf("parser %s: %s", p.Name, err.Error()))
+			}
+			err = addDelimitedParser(p.Name, newKeyOptions(p), o)
+			if err != nil {
+				return err
+			}
+		case "grok":
+			err := addGrokParser(p)
+			if err != nil {
+				return errors.New(fmt.Sprintf("parser %s: %s", p.Name, err.Error()))
+			}
 		default:
 			return errors.New("unknown parser type")
 		}
@@ -29,6 +84,23 @@ func AddCustomParsers() error {
 	return nil
 }
 
+// checkFields checks the field definitions of a custom parser
+func checkFields(p config.CustomParser) error {
+	for _, f := range p.RegexFields {
+		err := checkField(f.Field, f)
+		if err != nil {
+			return err
+		}
+	}
+	for name, f := range p.Fields {
+		err := checkField(name, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AddRegexParser adds a new regex parser to the list of available parsers
 func AddRegexParser(name string, fields config.RegexFields) error {
 	if name == "" {
@@ -44,3 +116,98 @@ func AddRegexParser(name string, fields config.RegexFields) error {
 	parsers[name] = Parser{format: name, parserType: RegexParserType, regexFields: fields, requireFields: len(fields)}
 	return nil
 }
+
+// addGrokParser compiles a grok expression and adds it to the list of available parsers
+func addGrokParser(p config.CustomParser) error {
+	patterns := make(map[string]string)
+
+	// Patterns defined in the configuration take precedence over those in the directory
+	if p.PatternsDir != "" {
+		tmp, err := LoadGrokPatterns(p.PatternsDir)
+		if err != nil {
+			return err
+		}
+		patterns = tmp
+	}
+	for k, v := range p.Patterns {
+		patterns[k] = v
+	}
+
+	pattern, fields, err := CompileGrok(p.Pattern, patterns, p.Fields)
+	if err != nil {
+		return err
+	}
+	return AddNamedRegexParser(p.Name, pattern, fields)
+}
+
+// AddNamedRegexParser adds a new parser using a regex with named groups to the list of available parsers
+func AddNamedRegexParser(name string, pattern string, fields map[string]config.RegexField) error {
+	if name == "" {
+		return errors.New("parser name cannot be empty")
+	}
+
+	if pattern == "" {
+		return errors.New("parser pattern cannot be empty")
+	}
+
+	// Check the pattern now rather than when a file is opened
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return errors.New(fmt.Sprintf("regex failed to compile: %s", err.Error()))
+	}
+
+	// Catch field definitions that do not match a group, which are likely typos
+	groups := make(map[string]bool)
+	for _, n := range r.SubexpNames() {
+		groups[n] = true
+	}
+	for n := range fields {
+		if !groups[n] {
+			return errors.New(fmt.Sprintf("regex has no group named %s", n))
+		}
+	}
+
+	parsersMX.Lock()
+	defer parsersMX.Unlock()
+	parsers[name] = Parser{format: name, parserType: NamedRegexParserType, pattern: pattern, namedFields: fields}
+	return nil
+}
+
+// namedFields fills in the field name and type for named groups where they are omitted
+func namedFields(fields map[string]config.RegexField) map[string]config.RegexField {
+	ret := make(map[string]config.RegexField)
+	for name, f := range fields {
+		if f.Field == "" {
+			f.Field = captureFieldName(name)
+		}
+		if f.FType == "" {
+			f.FType = "string"
+		}
+		ret[name] = f
+	}
+	return ret
+}
+
+// addKeyParser adds a new JSON or logfmt parser to the list of available parsers
+func addKeyParser(name string, parserType int, options keyOptions) error {
+	if name == "" {
+		return errors.New("parser name cannot be empty")
+	}
+
+	parsersMX.Lock()
+	defer parsersMX.Unlock()
+	parsers[name] = Parser{format: name, parserType: parserType, keyOptions: options}
+	return nil
+}
+
+// addDelimitedParser adds a new delimited parser to the list of available parsers
+func addDelimitedParser(name string, options keyOptions, delimited delimitedOptions) error {
+	if name == "" {
+		return errors.New("parser name cannot be empty")
+	}
+
+	parsersMX.Lock()
+	defer parsersMX.Unlock()
+	parsers[name] = Parser{format: name, parserType: DelimitedParserType, keyOptions: options, delimitedOptions: delimited}
+	return nil
+}
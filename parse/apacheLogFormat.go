@@ -0,0 +1,244 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"log2sqs/config"
+)
+
+// Regex fragments used for directives
+const (
+	regexToken  = `(\S+)`
+	regexQuoted = `((?:[^"\\]|\\.)*)`
+	regexAny    = `(.+?)`
+)
+
+// apacheDirective describes how to capture an Apache LogFormat directive
+type apacheDirective struct {
+	field      string
+	fType      string
+	dateFormat string
+	regex      string // overrides the default regex for the directive
+	short      bool   // use as the short_message
+}
+
+// Directives without a {parameter}. Field names match the built-in Apache parsers.
+var apacheDirectives = map[string]apacheDirective{
+	"a": {field: "_client_ip", fType: "string"},
+	"A": {field: "_local_ip", fType: "string"},
+	"B": {field: "_http_response_size", fType: "int"},
+	"b": {field: "_http_response_size", fType: "int"},
+	"D": {field: "_duration_usec", fType: "int"},
+	"f": {field: "_filename", fType: "string"},
+	"h": {field: "_src_ip", fType: "string"},
+	"H": {field: "_http_protocol", fType: "string"},
+	"I": {field: "_bytes_received", fType: "int"},
+	"k": {field: "_keepalive_requests", fType: "int"},
+	"l": {field: "_http_ident", fType: "string"},
+	"L": {field: "_log_id", fType: "string"},
+	"m": {field: "_http_request_method", fType: "string"},
+	"O": {field: "_http_response_size", fType: "int"},
+	"p": {field: "_vhost_port", fType: "int"},
+	"P": {field: "_pid", fType: "int"},
+	"q": {field: "_http_request_query", fType: "string"},
+	"r": {field: "_http_request", fType: "string", short: true},
+	"R": {field: "_handler", fType: "string"},
+	"s": {field: "_http_status", fType: "int"},
+	"S": {field: "_bytes_transferred", fType: "int"},
+	"t": {field: "timestamp", fType: "date", dateFormat: "02/Jan/2006:15:04:05 -0700", regex: `\[([^]]+)\]`},
+	"T": {field: "_duration_sec", fType: "int"},
+	"u": {field: "_user", fType: "string"},
+	"U": {field: "_http_request_path", fType: "string"},
+	"v": {field: "_vhost", fType: "string"},
+	"V": {field: "_server_name", fType: "string"},
+	"X": {field: "_connection_status", fType: "string"},
+}
+
+// Request headers (%{...}i) that have established field names
+var apacheHeaderFields = map[string]string{
+	"referer":           "_http_referer",
+	"user-agent":        "_user_agent",
+	"host":              "_http_host",
+	"x-forwarded-for":   "_x-forwarded-for",
+	"x-forwarded-proto": "_x-forwarded-proto",
+	"x-forwarded-port":  "_x-forwarded-port",
+}
+
+// Matches a directive: %, optional status code conditions and < or >, optional {parameter}, letter
+var apacheDirectiveRegex = regexp.MustCompile(`%[!0-9,]*[<>]?(?:\{([^}]*)\})?[<>]?([a-zA-Z%])`)
+
+// Matches a complete Apache LogFormat configuration line
+var apacheConfigLineRegex = regexp.MustCompile(`^\s*LogFormat\s+"(.*)"(?:\s+\S+)?\s*$`)
+
+// CompileApacheLogFormat converts an Apache LogFormat string, such as
+// %h %l %u %t \"%r\" %>s %O, into the equivalent numbered regex fields
+func CompileApacheLogFormat(format string) (config.RegexFields, error) {
+
+	// Accept a LogFormat line copied from the Apache configuration
+	if m := apacheConfigLineRegex.FindStringSubmatch(format); m != nil {
+		format = m[1]
+	}
+
+	// Quotes are escaped in the Apache configuration
+	format = strings.ReplaceAll(format, `\"`, `"`)
+
+	fields := config.RegexFields{}
+	used := map[string]int{}
+	literal := ""
+	quoted := false
+	pos := 0
+
+	for _, loc := range apacheDirectiveRegex.FindAllStringSubmatchIndex(format, -1) {
+		literal = literal + format[pos:loc[0]]
+		pos = loc[1]
+
+		param := ""
+		if loc[2] >= 0 {
+			param = format[loc[2]:loc[3]]
+		}
+		letter := format[loc[4]:loc[5]]
+
+		// %% is a literal percent sign
+		if letter == "%" {
+			literal = literal + "%"
+			continue
+		}
+
+		d, err := apacheDirectiveFor(letter, param)
+		if err != nil {
+			return nil, err
+		}
+
+		// Quotes in the literal text determine whether the directive is quoted
+		if strings.Count(literal, `"`)%2 == 1 {
+			quoted = !quoted
+		}
+
+		regex := d.regex
+		if regex == "" {
+			regex = regexToken
+			if quoted {
+				regex = regexQuoted
+			}
+		}
+
+		// Avoid overwriting a field that appears more than once
+		used[d.field]++
+		if used[d.field] > 1 {
+			d.field = fmt.Sprintf("%s_%d", d.field, used[d.field])
+		}
+
+		prefix := regexp.QuoteMeta(literal)
+		if len(fields) == 0 {
+			prefix = "^" + prefix
+		}
+
+		fields[len(fields)+1] = config.RegexField{
+			Regex:        prefix + regex,
+			Field:        d.field,
+			FType:        d.fType,
+			DateFormat:   d.dateFormat,
+			ShortMessage: d.short,
+		}
+		literal = ""
+	}
+
+	if len(fields) == 0 {
+		return nil, errors.New("LogFormat contains no directives")
+	}
+
+	// Add any trailing literal text to the last field
+	literal = literal + format[pos:]
+	last := fields[len(fields)]
+	last.Regex = last.Regex + regexp.QuoteMeta(literal) + "$"
+	fields[len(fields)] = last
+
+	return fields, nil
+}
+
+// apacheDirectiveFor returns the field definition for a directive letter and parameter
+func apacheDirectiveFor(letter string, param string) (apacheDirective, error) {
+	name := strings.ToLower(strings.NewReplacer("-", "_", " ", "_").Replace(param))
+
+	switch {
+	case param == "":
+		d, ok := apacheDirectives[letter]
+		if !ok {
+			return d, fmt.Errorf("unsupported LogFormat directive %%%s", letter)
+		}
+		return d, nil
+
+	case letter == "i":
+		if f, ok := apacheHeaderFields[strings.ToLower(param)]; ok {
+			return apacheDirective{field: f, fType: "string"}, nil
+		}
+		return apacheDirective{field: "_http_" + name, fType: "string"}, nil
+
+	case letter == "o":
+		return apacheDirective{field: "_http_response_" + name, fType: "string"}, nil
+
+	case letter == "C":
+		return apacheDirective{field: "_cookie_" + name, fType: "string"}, nil
+
+	case letter == "e":
+		return apacheDirective{field: "_env_" + name, fType: "string"}, nil
+
+	case letter == "n":
+		return apacheDirective{field: "_note_" + name, fType: "string"}, nil
+
+	case letter == "a":
+		if param == "c" {
+			return apacheDirective{field: "_peer_ip", fType: "string"}, nil
+		}
+
+	case letter == "p":
+		switch param {
+		case "canonical":
+			return apacheDirective{field: "_vhost_port", fType: "int"}, nil
+		case "local":
+			return apacheDirective{field: "_local_port", fType: "int"}, nil
+		case "remote":
+			return apacheDirective{field: "_remote_port", fType: "int"}, nil
+		}
+
+	case letter == "P":
+		switch param {
+		case "pid":
+			return apacheDirective{field: "_pid", fType: "int"}, nil
+		case "tid", "hextid":
+			return apacheDirective{field: "_tid", fType: "string"}, nil
+		}
+
+	case letter == "T":
+		switch param {
+		case "ms":
+			return apacheDirective{field: "_duration_msec", fType: "int"}, nil
+		case "us":
+			return apacheDirective{field: "_duration_usec", fType: "int"}, nil
+		case "s":
+			return apacheDirective{field: "_duration_sec", fType: "int"}, nil
+		}
+
+	case letter == "t":
+		switch param {
+		case "sec":
+			return apacheDirective{field: "timestamp", fType: "epoch_s"}, nil
+		case "msec":
+			return apacheDirective{field: "timestamp", fType: "epoch_ms"}, nil
+		case "usec":
+			return apacheDirective{field: "timestamp", fType: "epoch_us"}, nil
+		}
+
+		// Custom time formats may contain spaces
+		return apacheDirective{field: "_request_time", fType: "string", regex: regexAny}, nil
+	}
+
+	return apacheDirective{}, fmt.Errorf("unsupported LogFormat directive %%{%s}%s", param, letter)
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"log2sqs/config"
+)
+
+// parseTest is a line and the fields expected from it, or nil if the line should not parse
+type parseTest struct {
+	in     string
+	fields map[string]string
+}
+
+// testParser resets the configuration and returns a new parser for the format
+func testParser(t *testing.T, format string) *Parser {
+	config.Config = config.Data{}
+	config.SetDefaults()
+
+	p, err := New(format)
+	if err != nil {
+		t.Fatalf("New(%s): %s", format, err)
+	}
+	return p
+}
+
+// fieldString returns the printed value of a field. Timestamps are printed without an exponent.
+func fieldString(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// checkParser parses each line and compares the expected fields with their printed values
+func checkParser(t *testing.T, p *Parser, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		g, err := p.Parse(tt.in)
+		if tt.fields == nil {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want error", tt.in, g)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.in, err)
+			continue
+		}
+		for k, want := range tt.fields {
+			v, ok := g[k]
+			if want == "<none>" {
+				if ok {
+					t.Errorf("Parse(%q)[%s] = %#v, want no field", tt.in, k, v)
+				}
+				continue
+			}
+			if got := fieldString(v); !ok || got != want {
+				t.Errorf("Parse(%q)[%s] = %s, want %s", tt.in, k, got, want)
+			}
+		}
+	}
+}
+
+// addTestRegexParser compiles a LogFormat with the compiler and adds it as a parser
+func addTestRegexParser(t *testing.T, name string, compile func(string) (config.RegexFields, error), format string) *Parser {
+	fields, err := compile(format)
+	if err != nil {
+		t.Fatalf("compile %q: %s", format, err)
+	}
+	err = AddRegexParser(name, fields)
+	if err != nil {
+		t.Fatalf("AddRegexParser: %s", err)
+	}
+	return testParser(t, name)
+}
+
+func TestApacheLogFormat(t *testing.T) {
+	p := addTestRegexParser(t, "test_apache", CompileApacheLogFormat,
+		`LogFormat "%h %l %u %t \"%r\" %>s %O \"%{Referer}i\" \"%{User-Agent}i\" %D %{X-Request-ID}i %%" custom`)
+
+	checkParser(t, p, []parseTest{
+		{`192.168.1.20 - alice [11/Oct/2023:22:14:15 +0200] "GET /index.html?q=1 HTTP/1.1" 200 2326 "https://example.com/" "Mozilla/5.0 (X11; Linux x86_64)" 1532 abc-123 %`,
+			map[string]string{
+				"_src_ip":             "192.168.1.20",
+				"_http_ident":         "-",
+				"_user":               "alice",
+				"timestamp":           "1697055255",
+				"short_message":       "GET /index.html?q=1 HTTP/1.1",
+				"_http_status":        "200",
+				"_http_response_size": "2326",
+				"_http_referer":       "https://example.com/",
+				"_user_agent":         "Mozilla/5.0 (X11; Linux x86_64)",
+				"_duration_usec":      "1532",
+				"_http_x_request_id":  "abc-123",
+			}},
+		{`10.0.0.5 - - [11/Oct/2023:22:14:15 +0000] "GET /q?s=\"x\" HTTP/1.1" 404 0 "-" "curl/8.0 \"test\"" 87 - %`,
+			map[string]string{
+				"short_message": `GET /q?s=\"x\" HTTP/1.1`,
+				"_user_agent":   `curl/8.0 \"test\"`,
+				"_http_status":  "404",
+			}},
+		// Truncated lines and lines in another format do not match
+		{`192.168.1.20 - alice [11/Oct/2023:22:14:15 +0200] "GET /index.html HTTP/1.1" 200`, nil},
+		{`192.168.1.20 - - [11/Oct/2023:22:14:15 +0200] "GET / HTTP/1.1" 200 2326 "-" "curl/8.0"`, nil},
+		{``, nil},
+	})
+}
+
+func TestApacheLogFormatFields(t *testing.T) {
+	tests := []struct {
+		format string
+		fields []string // field names in order, or nil if the format should not compile
+	}{
+		{`%h %l %u %t "%r" %>s %b`, []string{"_src_ip", "_http_ident", "_user", "timestamp", "_http_request", "_http_status", "_http_response_size"}},
+		{`%v:%p %a %{c}a`, []string{"_vhost", "_vhost_port", "_client_ip", "_peer_ip"}},
+		{`%{Set-Cookie}o %{session}C %{UNIQUE_ID}e`, []string{"_http_response_set_cookie", "_cookie_session", "_env_unique_id"}},
+		{`%h %h`, []string{"_src_ip", "_src_ip_2"}},
+		{`%!200,304{Referer}i`, []string{"_http_referer"}},
+		{`%Z`, nil},
+		{`no directives`, nil},
+	}
+	for _, tt := range tests {
+		fields, err := CompileApacheLogFormat(tt.format)
+		if tt.fields == nil {
+			if err == nil {
+				t.Errorf("CompileApacheLogFormat(%q) succeeded", tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("CompileApacheLogFormat(%q): %s", tt.format, err)
+			continue
+		}
+		var got []string
+		for i := 1; i <= len(fields); i++ {
+			got = append(got, fields[i].Field)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.fields) {
+			t.Errorf("CompileApacheLogFormat(%q) fields = %v, want %v", tt.format, got, tt.fields)
+		}
+	}
+}
+
+func TestApacheBuiltIn(t *testing.T) {
+	checkParser(t, testParser(t, formatApacheCombined), []parseTest{
+		{`203.0.113.7 - - [11/Oct/2023:22:14:15 +0000] "POST /login HTTP/1.1" 302 154 "-" "Mozilla/5.0"`,
+			map[string]string{"_src_ip": "203.0.113.7", "_http_status": "302", "timestamp": "1697062455", "short_message": "POST /login HTTP/1.1"}},
+		{`203.0.113.7 - - [11/Oct/2023:22:14:15 +0000] "POST /login HTTP/1.1" 302`, nil},
+	})
+
+	checkParser(t, testParser(t, formatApacheError), []parseTest{
+		{`[Wed Oct 11 22:14:15.123456 2023] [core:error] [pid 1234:tid 140] [client 10.0.0.1:5000] AH00126: Invalid URI in request`,
+			map[string]string{
+				"timestamp":     "1697062455.123456",
+				"_apache_pid":   "pid 1234:tid 140",
+				"short_message": "[client 10.0.0.1:5000] AH00126: Invalid URI in request",
+			}},
+		{`[Wed Oct 11 22:14:15 2023] [error] short`, nil},
+	})
+}
@@ -0,0 +1,275 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+)
+
+// formatAuto selects the format that best matches the first lines of the input
+const formatAuto = "auto"
+
+// parserChain tries a list of parsers in turn. The last parser is always text, which keeps
+// the raw line when all others fail.
+type parserChain struct {
+	parsers []*Parser        // parsers in the order they are tried
+	sample  []*autoCandidate // all formats, while auto detection is sampling lines
+	sampled int              // number of lines sampled
+	pending []GELFMessage    // incomplete events of the formats that were not chosen
+}
+
+// autoCandidate tracks how well a format matches the sampled lines
+type autoCandidate struct {
+	parser  *Parser
+	matches int  // number of lines parsed
+	fields  int  // total number of fields in the parsed lines
+	generic bool // format that accepts most lines, such as logfmt or delimited
+	held    bool // consumed a line as the best format, for example into an incomplete event
+}
+
+// NewChain returns a parser for an input with the specified format and fallback formats.
+// If there are no fallback formats and the format is not auto, this is the same as New.
+func NewChain(format string, fallback []string) (*Parser, error) {
+	if format != formatAuto && len(fallback) == 0 {
+		return New(format)
+	}
+
+	c := &parserChain{}
+	if format == formatAuto {
+		sample, err := autoCandidates()
+		if err != nil {
+			return &Parser{}, err
+		}
+		c.sample = sample
+	} else {
+		fallback = append([]string{format}, fallback...)
+	}
+
+	for _, f := range fallback {
+		p, err := New(f)
+		if err != nil {
+			return &Parser{}, err
+		}
+		c.parsers = append(c.parsers, p)
+	}
+
+	if len(fallback) == 0 || fallback[len(fallback)-1] != formatText {
+		p, _ := New(formatText)
+		c.parsers = append(c.parsers, p)
+	}
+
+	return &Parser{format: format, parserType: ChainParserType, chain: c}, nil
+}
+
+// Format returns the formats the parser tries, separated by commas, so that a line can be
+// parsed again in the same way with NewChain. A chain that is still detecting the format of
+// its input starts with auto.
+func (p *Parser) Format() string {
+	if p.chain == nil {
+		return p.format
+	}
+
+	var formats []string
+	if p.chain.sample != nil {
+		formats = append(formats, formatAuto)
+	}
+	for _, cp := range p.chain.parsers {
+		formats = append(formats, cp.format)
+	}
+	return strings.Join(formats, ",")
+}
+
+// autoCandidates returns a parser for every format except text
+func autoCandidates() ([]*autoCandidate, error) {
+	parsersMX.RLock()
+	var formats []string
+	for name := range parsers {
+		if name != formatText {
+			formats = append(formats, name)
+		}
+	}
+	parsersMX.RUnlock()
+
+	// Sort for consistent results when formats match equally well
+	sort.Strings(formats)
+
+	var sample []*autoCandidate
+	for _, f := range formats {
+		p, err := New(f)
+		if err != nil {
+			return nil, err
+		}
+		generic := p.parserType == LogfmtParserType || p.parserType == DelimitedParserType
+		sample = append(sample, &autoCandidate{parser: p, generic: generic})
+	}
+	return sample, nil
+}
+
+// chainParser parses the line with the first parser that succeeds. The formats that failed
+// and the first error are recorded in _parse_failed and _parse_error.
+func (p *Parser) chainParser(s string) (GELFMessage, error) {
+	c := p.chain
+
+	var failed []string
+	var first error
+
+	if c.sample != nil {
+		g, err := c.detect(s)
+		if err == nil || errors.Is(err, ErrSkip) {
+			return g, err
+		}
+		failed = append(failed, formatAuto)
+		first = err
+	}
+
+	for _, cp := range c.parsers {
+		g, err := cp.Parse(s)
+		if err == nil {
+			if len(failed) > 0 {
+				g["_parse_failed"] = strings.Join(failed, ",")
+				g["_parse_error"] = first.Error()
+			}
+			return g, nil
+		}
+
+		// The line was consumed, for example as a header line
+		if errors.Is(err, ErrSkip) {
+			return g, err
+		}
+
+		failed = append(failed, cp.format)
+		if first == nil {
+			first = err
+		}
+	}
+
+	// Only possible if text is not the last parser
+	return GELFMessage{}, first
+}
+
+// detect parses a sampled line with every format and returns the result from the format
+// that has matched best so far. After AutoSampleLines lines, the best format is placed at
+// the start of the chain.
+func (c *parserChain) detect(s string) (GELFMessage, error) {
+	var best *autoCandidate
+	var result GELFMessage
+	var resultErr error
+
+	for _, a := range c.sample {
+		g, err := a.parser.Parse(s)
+		if err != nil && !errors.Is(err, ErrSkip) {
+			continue
+		}
+		if err == nil && !a.parser.autoMatch(s) {
+			continue
+		}
+
+		// Lines consumed by a format, such as header lines, count as matches
+		a.matches++
+		a.fields += len(g)
+		if best == nil || a.better(best) {
+			best = a
+			result, resultErr = g, err
+		}
+	}
+
+	if best != nil && errors.Is(resultErr, ErrSkip) {
+		best.held = true
+	}
+
+	c.sampled++
+	if c.sampled >= config.Config.AutoSampleLines {
+		c.decide()
+	}
+
+	if best == nil {
+		return GELFMessage{}, errors.New("no format matched")
+	}
+	return result, resultErr
+}
+
+// decide ends sampling and places the best matching format at the start of the chain. Its
+// parser keeps any incomplete event. The incomplete events of other formats that consumed
+// lines while they matched best are kept for flush, as those lines were not returned.
+func (c *parserChain) decide() {
+	var best *autoCandidate
+	for _, a := range c.sample {
+		if a.matches > 0 && (best == nil || a.better(best)) {
+			best = a
+		}
+	}
+
+	if best != nil {
+		c.parsers = append([]*Parser{best.parser}, c.parsers...)
+	}
+
+	for _, a := range c.sample {
+		if a == best || !a.held {
+			continue
+		}
+		for {
+			g, ok := a.parser.Flush(0)
+			if !ok {
+				break
+			}
+			c.pending = append(c.pending, g)
+		}
+	}
+	c.sample = nil
+}
+
+// better returns true if a has matched more lines than b. Specific formats are preferred over
+// generic ones, and then formats that extract more fields.
+func (a *autoCandidate) better(b *autoCandidate) bool {
+	if a.matches != b.matches {
+		return a.matches > b.matches
+	}
+	if a.generic != b.generic {
+		return !a.generic
+	}
+	return a.fields > b.fields
+}
+
+// autoMatch returns true if a line that parsed without error really is in the format. Generic
+// formats accept almost any line, so they must match more closely.
+func (p *Parser) autoMatch(s string) bool {
+	switch p.parserType {
+	case LogfmtParserType:
+		// Every pair must have a delimiter
+		pairs := splitPairs(s, p.keyOptions.pairSeparator, p.keyOptions.delimiter)
+		return strings.Count(s, p.keyOptions.delimiter) >= len(pairs)
+	case DelimitedParserType:
+		// The line must have one value for each column
+		values, err := p.delimitedOptions.split(s)
+		return err == nil && len(values) == len(p.delimitedOptions.columns)
+	}
+	return true
+}
+
+// flush returns an incomplete event from any of the parsers in the chain. Events kept when
+// auto detection ended are returned first.
+func (c *parserChain) flush(timeout time.Duration) (GELFMessage, bool) {
+	if len(c.pending) > 0 {
+		g := c.pending[0]
+		c.pending = c.pending[1:]
+		return g, true
+	}
+	for _, p := range c.parsers {
+		if g, ok := p.Flush(timeout); ok {
+			return g, true
+		}
+	}
+	for _, a := range c.sample {
+		if g, ok := a.parser.Flush(timeout); ok {
+			return g, true
+		}
+	}
+	return GELFMessage{}, false
+}
@@ -0,0 +1,133 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"testing"
+
+	"log2sqs/config"
+)
+
+func TestChainFallback(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+
+	p, err := NewChain("json", []string{"combined", "logfmt"})
+	if err != nil {
+		t.Fatalf("NewChain: %s", err)
+	}
+	if got := p.Format(); got != "json,combined,logfmt,text" {
+		t.Errorf("Format = %s", got)
+	}
+
+	tests := []struct {
+		in     string
+		format string
+		failed string
+	}{
+		{`{"msg":"hello","level":"info"}`, "json", ""},
+		{`10.0.0.1 - - [11/Oct/2023:22:14:15 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`, "combined", "json"},
+		{`msg=hello level=info debug`, "logfmt", "json,combined"},
+		{`just some text`, "PlainText", "json,combined,logfmt"},
+	}
+	for _, tt := range tests {
+		g, err := p.Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.in, err)
+			continue
+		}
+		if g["_original_format"] != tt.format {
+			t.Errorf("Parse(%q) format = %v, want %s", tt.in, g["_original_format"], tt.format)
+		}
+		if failed, _ := g["_parse_failed"].(string); failed != tt.failed {
+			t.Errorf("Parse(%q) _parse_failed = %q, want %q", tt.in, failed, tt.failed)
+		}
+	}
+}
+
+func TestChainAutoKeepsIncompleteEvent(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.AutoSampleLines = 2
+
+	p, err := NewChain(formatAuto, nil)
+	if err != nil {
+		t.Fatalf("NewChain: %s", err)
+	}
+	if got := p.Format(); got != "auto,text" {
+		t.Errorf("Format while sampling = %s", got)
+	}
+
+	// Detection settles while the event is incomplete
+	lines := []string{
+		`type=SYSCALL msg=audit(1697000000.123:42): arch=c000003e syscall=59 success=yes exe="/usr/bin/ls"`,
+		`type=CWD msg=audit(1697000000.123:42): cwd="/root"`,
+		`type=PATH msg=audit(1697000000.123:42): item=0 name="/usr/bin/ls"`,
+	}
+	for _, line := range lines {
+		if _, err := p.Parse(line); !errors.Is(err, ErrSkip) {
+			t.Fatalf("Parse(%q) = %v, want ErrSkip", line, err)
+		}
+	}
+	if got := p.Format(); got != "auditd,text" {
+		t.Errorf("Format after sampling = %s", got)
+	}
+
+	g, err := p.Parse(`type=EOE msg=audit(1697000000.123:42):`)
+	if err != nil {
+		t.Fatalf("Parse(EOE): %s", err)
+	}
+	if g["_audit_types"] != "SYSCALL,CWD,PATH" {
+		t.Errorf("_audit_types = %v, want all records", g["_audit_types"])
+	}
+}
+
+func TestChainAutoDetect(t *testing.T) {
+	tests := []struct {
+		lines  []string
+		format string
+	}{
+		{[]string{
+			`{"level":"info","msg":"started","port":8080}`,
+			`{"level":"warn","msg":"slow","ms":1200}`,
+			`{"level":"info","msg":"stopped"}`,
+		}, "json,text"},
+		{[]string{
+			`10.0.0.1 - - [11/Oct/2023:22:14:15 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`,
+			`10.0.0.2 - bob [11/Oct/2023:22:14:16 +0000] "POST /login HTTP/1.1" 302 0 "https://example.com/" "Mozilla/5.0"`,
+			`10.0.0.3 - - [11/Oct/2023:22:14:17 +0000] "GET /favicon.ico HTTP/1.1" 404 153 "-" "Mozilla/5.0"`,
+		}, "combined,text"},
+		{[]string{
+			`time=2023-10-11T22:14:15Z level=info msg="request done" status=200`,
+			`time=2023-10-11T22:14:16Z level=error msg="request failed" status=500`,
+			`time=2023-10-11T22:14:17Z level=info msg="request done" status=204`,
+		}, "logfmt,text"},
+		{[]string{
+			`2023/10/11 22:14:15 [error] 1234#5678: *99 open() "/var/www/favicon.ico" failed (2: No such file or directory)`,
+			`2023/10/11 22:14:16 [warn] 1234#5678: *100 an upstream response is buffered to a temporary file`,
+			`2023/10/11 22:14:17 [notice] 1234#1234: signal process started`,
+		}, "nginxerror,text"},
+	}
+
+	for _, tt := range tests {
+		config.Config = config.Data{}
+		config.SetDefaults()
+		config.Config.AutoSampleLines = len(tt.lines)
+
+		p, err := NewChain(formatAuto, nil)
+		if err != nil {
+			t.Fatalf("NewChain: %s", err)
+		}
+		for _, line := range tt.lines {
+			if _, err := p.Parse(line); err != nil {
+				t.Errorf("Parse(%q): %s", line, err)
+			}
+		}
+		if got := p.Format(); got != tt.format {
+			t.Errorf("Format after %q = %s, want %s", tt.lines[0], got, tt.format)
+		}
+	}
+}
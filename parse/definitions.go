@@ -7,17 +7,25 @@ package parse
 import (
 	"regexp"
 	"sync"
+	"time"
 
 	"log2sqs/config"
 )
 
 // Parser defines a parser object
 type Parser struct {
-	format        string             // name of the format
-	parserType    int                // parser type
-	requireFields int                // number of fields required to be present
-	regexFields   config.RegexFields // map of regexes for each Field to put them in the correct order
-	regex         *regexp.Regexp     // pointer to the compiled regex
+	format           string                       // name of the format
+	parserType       int                          // parser type
+	requireFields    int                          // number of fields required to be present
+	regexFields      config.RegexFields           // map of regexes for each Field to put them in the correct order
+	regex            *regexp.Regexp               // pointer to the compiled regex
+	pattern          string                       // regex with named groups
+	namedFields      map[string]config.RegexField // field for each named group
+	keyOptions       keyOptions                   // key mapping for JSON and logfmt parsers
+	delimitedOptions delimitedOptions             // columns for delimited parsers
+	audit            map[string]*auditEvent       // incomplete auditd events by serial number
+	chain            *parserChain                 // parsers tried in turn for an input with fallback formats
+	location         *time.Location               // time zone of dates without a zone
 }
 
 // GELFMessage type can hold GELF fields of various types
@@ -27,22 +35,46 @@ type GELFMessage map[string]interface{}
 const (
 	formatGelf                       = "gelf"
 	formatText                       = "text"
+	formatJSON                       = "json"
+	formatLogfmt                     = "logfmt"
+	formatW3C                        = "w3c"
+	formatZeek                       = "zeek"
 	formatApacheError                = "error"
 	formatApacheCombined             = "combined"
 	formatApacheCombinedPlus         = "combinedplus"
 	formatApacheCombinedPlusVhost    = "combinedplusvhost"
 	formatApacheCombinedLoadBalancer = "combinedloadbalancer"
+	formatNginxMain                  = "nginxmain"
+	formatNginxError                 = "nginxerror"
+	formatAWSALB                     = "awsalb"
+	formatAWSELB                     = "awselb"
+	formatAWSCloudFront              = "awscloudfront"
+	formatAWSS3                      = "awss3"
+	formatAWSVPCFlow                 = "awsvpcflow"
+	formatAuditd                     = "auditd"
 )
 
 var parsersMX = sync.RWMutex{}
 var parsers = map[string]Parser{
 	formatGelf:                       {format: formatGelf, parserType: GelfParserType},
 	formatText:                       {format: formatText, parserType: PlainTextParserType},
+	formatJSON:                       {format: formatJSON, parserType: JSONParserType, keyOptions: defaultKeyOptions},
+	formatLogfmt:                     {format: formatLogfmt, parserType: LogfmtParserType, keyOptions: defaultKeyOptions},
+	formatW3C:                        {format: formatW3C, parserType: DelimitedParserType, keyOptions: defaultKeyOptions, delimitedOptions: delimitedOptions{delimiter: ' ', quotes: true, unset: "-"}},
+	formatZeek:                       {format: formatZeek, parserType: DelimitedParserType, keyOptions: defaultKeyOptions, delimitedOptions: delimitedOptions{delimiter: '\t', unset: "-"}},
 	formatApacheError:                {format: formatApacheError, parserType: RegexParserType, regexFields: apacheErrorRegex, requireFields: 5},
 	formatApacheCombined:             {format: formatApacheCombined, parserType: RegexParserType, regexFields: apacheCombinedRegex, requireFields: 9},
 	formatApacheCombinedPlus:         {format: formatApacheCombinedPlus, parserType: RegexParserType, regexFields: apacheCombinedPlusRegex, requireFields: 13},
 	formatApacheCombinedPlusVhost:    {format: formatApacheCombinedPlusVhost, parserType: RegexParserType, regexFields: apacheCombinedPlusVhostRegex, requireFields: 15},
 	formatApacheCombinedLoadBalancer: {format: formatApacheCombinedLoadBalancer, parserType: RegexParserType, regexFields: apacheCombinedLoadBalancerRegex, requireFields: 17},
+	formatNginxMain:                  {format: formatNginxMain, parserType: RegexParserType, regexFields: nginxMainRegex, requireFields: len(nginxMainRegex)},
+	formatNginxError:                 {format: formatNginxError, parserType: RegexParserType, regexFields: nginxErrorRegex, requireFields: 6},
+	formatAWSALB:                     {format: formatAWSALB, parserType: NamedRegexParserType, pattern: awsALBPattern, namedFields: awsALBFields},
+	formatAWSELB:                     {format: formatAWSELB, parserType: NamedRegexParserType, pattern: awsELBPattern, namedFields: awsELBFields},
+	formatAWSCloudFront:              {format: formatAWSCloudFront, parserType: DelimitedParserType, keyOptions: awsCloudFrontOptions, delimitedOptions: delimitedOptions{delimiter: '\t', unset: "-", columns: awsCloudFrontColumns}},
+	formatAWSS3:                      {format: formatAWSS3, parserType: NamedRegexParserType, pattern: awsS3Pattern, namedFields: awsS3Fields},
+	formatAuditd:                     {format: formatAuditd, parserType: AuditdParserType},
+	formatAWSVPCFlow:                 {format: formatAWSVPCFlow, parserType: DelimitedParserType, keyOptions: awsVPCFlowOptions, delimitedOptions: delimitedOptions{delimiter: ' ', unset: "-", headerRow: true, columns: awsVPCFlowColumns}},
 }
 
 var apacheErrorRegex = config.RegexFields{
@@ -85,7 +117,7 @@ var apacheCombinedPlusRegex = config.RegexFields{
 
 // LogFormat "%v:%p %h %l %u %t \"%r\" %>s %O \"%{Referer}i\" \"%{User-Agent}i\" %D \"%m\" \"%U\" \"%q\"" combinedplusvhost
 var apacheCombinedPlusVhostRegex = config.RegexFields{
-	1:  {Regex: `$(\S+):`, Field: "_vhost", FType: "string"},
+	1:  {Regex: `^(\S+):`, Field: "_vhost", FType: "string"},
 	2:  {Regex: `(\S+)\s`, Field: "_vhost_port", FType: "int"},
 	3:  {Regex: `(\S+)\s`, Field: "_src_ip", FType: "string"},
 	4:  {Regex: `(\S+)\s`, Field: "_http_ident", FType: "string"},
@@ -122,3 +154,156 @@ var apacheCombinedLoadBalancerRegex = config.RegexFields{
 	16: {Regex: `"(.*?)"\s`, Field: "_http_request_path", FType: "string"},
 	17: {Regex: `"(.*?)"$`, Field: "_http_request_query", FType: "string"},
 }
+
+// log_format main '$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"'
+var nginxMainRegex = mustCompileNginxLogFormat(`$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`)
+
+// 2023/10/10 13:55:36 [error] 1234#5678: *99 open() "/var/www/favicon.ico" failed (2: No such file or directory), client: 10.0.0.1
+var nginxErrorRegex = config.RegexFields{
+	1: {Regex: `^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})\s`, Field: "timestamp", FType: "date", DateFormat: "2006/01/02 15:04:05 -0700", AddTZ: true},
+	2: {Regex: `\[(\w+)\]\s`, Field: "_nginx_level", FType: "string"},
+	3: {Regex: `(\d+)#`, Field: "_pid", FType: "int"},
+	4: {Regex: `(\d+):\s`, Field: "_tid", FType: "int"},
+	5: {Regex: `(?:\*(\d+)\s)?`, Field: "_connection", FType: "int"},
+	6: {Regex: `(.*?)$`, Field: "short_message", FType: "string"},
+}
+
+// Application Load Balancer access log. Fields added over time are optional.
+// http 2018-07-02T22:23:00.186641Z app/my-lb/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - arn:aws:elasticloadbalancing:... "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"
+var awsALBPattern = `^(?P<type>\S+) (?P<timestamp>\S+) (?P<elb>\S+) (?P<client_ip>\S+):(?P<client_port>\d+) (?:(?P<target_ip>\S+):(?P<target_port>\d+)|-) ` +
+	`(?P<request_processing_time>\S+) (?P<target_processing_time>\S+) (?P<response_processing_time>\S+) ` +
+	`(?:(?P<elb_status_code>\d+)|-) (?:(?P<target_status_code>\d+)|-) (?P<received_bytes>\d+) (?P<sent_bytes>\d+) ` +
+	`"(?P<request>[^"]*)" "(?P<user_agent>(?:[^"\\]|\\.)*)" (?P<ssl_cipher>\S+) (?P<ssl_protocol>\S+) (?P<target_group_arn>\S+)` +
+	`(?: "(?P<trace_id>[^"]*)"(?: "(?P<domain_name>[^"]*)" "(?P<chosen_cert_arn>[^"]*)"` +
+	`(?: (?P<matched_rule_priority>\S+) (?P<request_creation_time>\S+) "(?P<actions_executed>[^"]*)"` +
+	`(?: "(?P<redirect_url>[^"]*)"(?: "(?P<error_reason>[^"]*)"(?: "(?P<target_port_list>[^"]*)" "(?P<target_status_code_list>[^"]*)"` +
+	`(?: "(?P<classification>[^"]*)" "(?P<classification_reason>[^"]*)"(?: (?P<conn_trace_id>\S+))?)?)?)?)?)?)?)?`
+
+var awsALBFields = map[string]config.RegexField{
+	"type":                     {Field: "_alb_type", FType: "string"},
+	"timestamp":                {Field: "timestamp", FType: "date", DateFormat: "2006-01-02T15:04:05Z07:00"},
+	"elb":                      {Field: "_elb", FType: "string"},
+	"client_ip":                {Field: "_src_ip", FType: "string"},
+	"client_port":              {Field: "_src_port", FType: "int"},
+	"target_ip":                {Field: "_target_ip", FType: "string"},
+	"target_port":              {Field: "_target_port", FType: "int"},
+	"request_processing_time":  {Field: "_request_processing_time", FType: "float"},
+	"target_processing_time":   {Field: "_target_processing_time", FType: "float"},
+	"response_processing_time": {Field: "_response_processing_time", FType: "float"},
+	"elb_status_code":          {Field: "_http_status", FType: "int"},
+	"target_status_code":       {Field: "_target_status_code", FType: "int"},
+	"received_bytes":           {Field: "_bytes_received", FType: "int"},
+	"sent_bytes":               {Field: "_bytes_sent", FType: "int"},
+	"request":                  {Field: "_http_request", FType: "string", ShortMessage: true},
+	"user_agent":               {Field: "_user_agent", FType: "string"},
+	"matched_rule_priority":    {Field: "_matched_rule_priority", FType: "string"},
+	"request_creation_time":    {Field: "_request_creation_time", FType: "string"},
+	"target_port_list":         {Field: "_target_port_list", FType: "list"},
+	"target_status_code_list":  {Field: "_target_status_code_list", FType: "intlist"},
+}
+
+// Classic Load Balancer access log
+// 2015-05-13T23:39:43.945958Z my-lb 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -
+var awsELBPattern = `^(?P<timestamp>\S+) (?P<elb>\S+) (?P<client_ip>\S+):(?P<client_port>\d+) (?:(?P<backend_ip>\S+):(?P<backend_port>\d+)|-) ` +
+	`(?P<request_processing_time>\S+) (?P<backend_processing_time>\S+) (?P<response_processing_time>\S+) ` +
+	`(?:(?P<elb_status_code>\d+)|-) (?:(?P<backend_status_code>\d+)|-) (?P<received_bytes>\d+) (?P<sent_bytes>\d+) ` +
+	`"(?P<request>[^"]*)"(?: "(?P<user_agent>(?:[^"\\]|\\.)*)" (?P<ssl_cipher>\S+) (?P<ssl_protocol>\S+))?`
+
+var awsELBFields = map[string]config.RegexField{
+	"timestamp":                {Field: "timestamp", FType: "date", DateFormat: "2006-01-02T15:04:05Z07:00"},
+	"elb":                      {Field: "_elb", FType: "string"},
+	"client_ip":                {Field: "_src_ip", FType: "string"},
+	"client_port":              {Field: "_src_port", FType: "int"},
+	"backend_ip":               {Field: "_backend_ip", FType: "string"},
+	"backend_port":             {Field: "_backend_port", FType: "int"},
+	"request_processing_time":  {Field: "_request_processing_time", FType: "float"},
+	"backend_processing_time":  {Field: "_backend_processing_time", FType: "float"},
+	"response_processing_time": {Field: "_response_processing_time", FType: "float"},
+	"elb_status_code":          {Field: "_http_status", FType: "int"},
+	"backend_status_code":      {Field: "_backend_status_code", FType: "int"},
+	"received_bytes":           {Field: "_bytes_received", FType: "int"},
+	"sent_bytes":               {Field: "_bytes_sent", FType: "int"},
+	"request":                  {Field: "_http_request", FType: "string", ShortMessage: true},
+	"user_agent":               {Field: "_user_agent", FType: "string"},
+}
+
+// CloudFront standard log. The columns are replaced by the #Fields header line if present.
+var awsCloudFrontColumns = []string{"date", "time", "x-edge-location", "sc-bytes", "c-ip", "cs-method", "cs(Host)",
+	"cs-uri-stem", "sc-status", "cs(Referer)", "cs(User-Agent)", "cs-uri-query", "cs(Cookie)", "x-edge-result-type",
+	"x-edge-request-id", "x-host-header", "cs-protocol", "cs-bytes", "time-taken", "x-forwarded-for", "ssl-protocol",
+	"ssl-cipher", "x-edge-response-result-type", "cs-protocol-version", "fle-status", "fle-encrypted-fields", "c-port",
+	"time-to-first-byte", "x-edge-detailed-result-type", "sc-content-type", "sc-content-len", "sc-range-start", "sc-range-end"}
+
+var awsCloudFrontOptions = keyOptions{
+	timestampKeys: []string{"timestamp"},
+	separator:     "_",
+	fields: map[string]config.RegexField{
+		"x-edge-location":    {Field: "_edge_location", FType: "string"},
+		"sc-bytes":           {Field: "_bytes_sent", FType: "int"},
+		"c-ip":               {Field: "_src_ip", FType: "string"},
+		"cs-method":          {Field: "_http_request_method", FType: "string"},
+		"cs(Host)":           {Field: "_http_host", FType: "string"},
+		"cs-uri-stem":        {Field: "_http_request_path", FType: "string", ShortMessage: true},
+		"sc-status":          {Field: "_http_status", FType: "int"},
+		"cs(Referer)":        {Field: "_http_referer", FType: "string"},
+		"cs(User-Agent)":     {Field: "_user_agent", FType: "string"},
+		"cs-uri-query":       {Field: "_http_request_query", FType: "string"},
+		"cs(Cookie)":         {Field: "_http_cookie", FType: "string"},
+		"x-edge-request-id":  {Field: "_edge_request_id", FType: "string"},
+		"cs-bytes":           {Field: "_bytes_received", FType: "int"},
+		"time-taken":         {Field: "_time_taken", FType: "float"},
+		"time-to-first-byte": {Field: "_time_to_first_byte", FType: "float"},
+		"c-port":             {Field: "_src_port", FType: "int"},
+		"x-forwarded-for":    {Field: "_x-forwarded-for", FType: "list"},
+	},
+}
+
+// S3 server access log. Fields added over time are optional.
+// 79a59df9... awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 79a59df9... 3E57427F3EXAMPLE REST.GET.VERSIONING - "GET /awsexamplebucket1?versioning HTTP/1.1" 200 - 113 - 7 - "-" "S3Console/0.4" - s9lzHYrFp76ZVxRcpX9+5cjAnEH2ROuNkd2BHfIa6UkFVdtjf5mKR3/eTPFvsiP/XV/VLi31234= SigV4 ECDHE-RSA-AES128-GCM-SHA256 AuthHeader awsexamplebucket1.s3.us-west-1.amazonaws.com TLSV1.2 - -
+var awsS3Pattern = `^(?P<bucket_owner>\S+) (?P<bucket>\S+) \[(?P<timestamp>[^]]+)\] (?P<remote_ip>\S+) (?P<requester>\S+) (?P<request_id>\S+) ` +
+	`(?P<operation>\S+) (?P<key>\S+) "(?P<request_uri>[^"]*)" (?:(?P<http_status>\d+)|-) (?P<error_code>\S+) ` +
+	`(?:(?P<bytes_sent>\d+)|-) (?:(?P<object_size>\d+)|-) (?:(?P<total_time>\d+)|-) (?:(?P<turn_around_time>\d+)|-) ` +
+	`"(?P<referer>(?:[^"\\]|\\.)*)" "(?P<user_agent>(?:[^"\\]|\\.)*)" (?P<version_id>\S+)` +
+	`(?: (?P<host_id>\S+) (?P<signature_version>\S+) (?P<cipher_suite>\S+) (?P<authentication_type>\S+) (?P<host_header>\S+) (?P<tls_version>\S+)` +
+	`(?: (?P<access_point_arn>\S+)(?: (?P<acl_required>\S+))?)?)?`
+
+var awsS3Fields = map[string]config.RegexField{
+	"bucket_owner":     {Field: "_bucket_owner", FType: "string"},
+	"bucket":           {Field: "_bucket", FType: "string"},
+	"timestamp":        {Field: "timestamp", FType: "date", DateFormat: "02/Jan/2006:15:04:05 -0700"},
+	"remote_ip":        {Field: "_src_ip", FType: "string"},
+	"operation":        {Field: "_operation", FType: "string"},
+	"key":              {Field: "_key", FType: "string"},
+	"request_uri":      {Field: "_http_request", FType: "string", ShortMessage: true},
+	"http_status":      {Field: "_http_status", FType: "int"},
+	"bytes_sent":       {Field: "_bytes_sent", FType: "int"},
+	"object_size":      {Field: "_object_size", FType: "int"},
+	"total_time":       {Field: "_total_time_msec", FType: "int"},
+	"turn_around_time": {Field: "_turn_around_time_msec", FType: "int"},
+	"referer":          {Field: "_http_referer", FType: "string"},
+	"user_agent":       {Field: "_user_agent", FType: "string"},
+}
+
+// VPC flow log, default version 2 format. Logs delivered to S3 start with a header line that
+// replaces the columns, so custom formats with version 3 to 5 fields are also handled.
+var awsVPCFlowColumns = []string{"version", "account-id", "interface-id", "srcaddr", "dstaddr", "srcport", "dstport",
+	"protocol", "packets", "bytes", "start", "end", "action", "log-status"}
+
+var awsVPCFlowOptions = keyOptions{
+	timestampKeys: []string{"start"},
+	separator:     "_",
+	fields: map[string]config.RegexField{
+		"account-id":   {Field: "_account_id", FType: "string"},
+		"srcaddr":      {Field: "_src_ip", FType: "string"},
+		"dstaddr":      {Field: "_dst_ip", FType: "string"},
+		"srcport":      {Field: "_src_port", FType: "int"},
+		"dstport":      {Field: "_dst_port", FType: "int"},
+		"pkt-srcaddr":  {Field: "_pkt_src_ip", FType: "string"},
+		"pkt-dstaddr":  {Field: "_pkt_dst_ip", FType: "string"},
+		"end":          {Field: "_end", FType: "int"},
+		"subnet-id":    {Field: "_subnet_id", FType: "string"},
+		"vpc-id":       {Field: "_vpc_id", FType: "string"},
+		"instance-id":  {Field: "_instance_id", FType: "string"},
+		"interface-id": {Field: "_interface_id", FType: "string"},
+	},
+}
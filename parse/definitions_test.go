@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"testing"
+)
+
+func TestAWSALB(t *testing.T) {
+	checkParser(t, testParser(t, formatAWSALB), []parseTest{
+		{`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`,
+			map[string]string{
+				"_alb_type":                "http",
+				"timestamp":                "1530570180.186641",
+				"_elb":                     "app/my-loadbalancer/50dc6c495c0c9188",
+				"_src_ip":                  "192.168.131.39",
+				"_src_port":                "2817",
+				"_target_ip":               "10.0.0.1",
+				"_target_port":             "80",
+				"_target_processing_time":  "0.001",
+				"_http_status":             "200",
+				"_bytes_received":          "34",
+				"_bytes_sent":              "366",
+				"short_message":            "GET http://www.example.com:80/ HTTP/1.1",
+				"_user_agent":              "curl/7.46.0",
+				"_trace_id":                "Root=1-58337262-36d228ad5d99923122bbe354",
+				"_actions_executed":        "forward",
+				"_target_port_list":        "10.0.0.1:80",
+				"_target_status_code_list": "200",
+			}},
+		// The target did not respond, and an older log without the later fields
+		{`https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 - -1 -1 -1 502 - 34 366 "GET https://www.example.com:443/ HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067`,
+			map[string]string{"_target_ip": "<none>", "_http_status": "502", "_target_status_code": "<none>", "_ssl_protocol": "TLSv1.2", "_trace_id": "<none>"}},
+		{`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000`, nil},
+	})
+}
+
+func TestAWSELB(t *testing.T) {
+	checkParser(t, testParser(t, formatAWSELB), []parseTest{
+		{`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`,
+			map[string]string{
+				"timestamp":                "1431560383.945958",
+				"_elb":                     "my-loadbalancer",
+				"_backend_ip":              "10.0.0.1",
+				"_backend_processing_time": "0.001048",
+				"_http_status":             "200",
+				"_bytes_sent":              "29",
+				"short_message":            "GET http://www.example.com:80/ HTTP/1.1",
+				"_user_agent":              "curl/7.38.0",
+			}},
+		// TCP listener
+		{`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.001069 0.000028 0.000041 - - 82 305 "- - - " "-" - -`,
+			map[string]string{"_http_status": "<none>", "_bytes_received": "82", "short_message": "- - -"}},
+		{`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817`, nil},
+	})
+}
+
+func TestAWSCloudFront(t *testing.T) {
+	checkParser(t, testParser(t, formatAWSCloudFront), []parseTest{
+		{"#Version: 1.0", nil},
+		{"2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\t-\tMozilla/5.0%20(Windows%20NT%2010.0;%20Win64;%20x64)\t-\t-\tHit\tSOX4xwn4XV6Q4rgb7XiVGOHms_BGlTAC4KyHmureZmBNrjGdRLiNIQ==\td111111abcdef8.cloudfront.net\thttps\t23\t0.001\t-\tTLSv1.2\tECDHE-RSA-AES128-GCM-SHA256\tHit\tHTTP/2.0\t-\t-\t11040\t0.001\tHit\ttext/html\t78\t-\t-",
+			map[string]string{
+				"timestamp":           "1575493351",
+				"_edge_location":      "LAX1",
+				"_bytes_sent":         "392",
+				"_src_ip":             "192.0.2.100",
+				"_http_request_path":  "/index.html",
+				"short_message":       "/index.html",
+				"_http_status":        "200",
+				"_http_referer":       "<none>",
+				"_time_taken":         "0.001",
+				"_src_port":           "11040",
+				"_x-edge-result-type": "Hit",
+			}},
+		{"2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100",
+			map[string]string{"_src_ip": "192.0.2.100", "_http_status": "<none>"}},
+	})
+}
+
+func TestAWSS3(t *testing.T) {
+	checkParser(t, testParser(t, formatAWSS3), []parseTest{
+		{`79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be 3E57427F3EXAMPLE REST.GET.VERSIONING - "GET /awsexamplebucket1?versioning HTTP/1.1" 200 - 113 - 7 - "-" "S3Console/0.4" - s9lzHYrFp76ZVxRcpX9+5cjAnEH2ROuNkd2BHfIa6UkFVdtjf5mKR3/eTPFvsiP/XV/VLi31234= SigV4 ECDHE-RSA-AES128-GCM-SHA256 AuthHeader awsexamplebucket1.s3.us-west-1.amazonaws.com TLSV1.2 - -`,
+			map[string]string{
+				"_bucket":          "awsexamplebucket1",
+				"timestamp":        "1549411238",
+				"_src_ip":          "192.0.2.3",
+				"_operation":       "REST.GET.VERSIONING",
+				"short_message":    "GET /awsexamplebucket1?versioning HTTP/1.1",
+				"_http_status":     "200",
+				"_bytes_sent":      "113",
+				"_object_size":     "<none>",
+				"_total_time_msec": "7",
+				"_user_agent":      "S3Console/0.4",
+				"_tls_version":     "TLSV1.2",
+			}},
+		// An older log without the later fields
+		{`79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be awsexamplebucket1 [06/Feb/2019:00:00:38 +0000] 192.0.2.3 - 3E57427F3EXAMPLE REST.PUT.OBJECT photos/cat.jpg "PUT /awsexamplebucket1/photos/cat.jpg HTTP/1.1" 403 AccessDenied 243 - 12 - "-" "aws-cli/2.0" -`,
+			map[string]string{"_key": "photos/cat.jpg", "_http_status": "403", "_error_code": "AccessDenied", "_tls_version": "<none>"}},
+		{`79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be awsexamplebucket1 [06/Feb/2019:00:00:38 +0000]`, nil},
+	})
+}
+
+func TestAWSVPCFlow(t *testing.T) {
+	checkParser(t, testParser(t, formatAWSVPCFlow), []parseTest{
+		// The default format without a header
+		{`2 123456789010 eni-1235b8ca123456789 172.31.16.139 172.31.16.21 20641 22 6 20 4249 1418530010 1418530070 ACCEPT OK`,
+			map[string]string{
+				"timestamp":     "1418530010",
+				"_account_id":   "123456789010",
+				"_interface_id": "eni-1235b8ca123456789",
+				"_src_ip":       "172.31.16.139",
+				"_dst_ip":       "172.31.16.21",
+				"_src_port":     "20641",
+				"_dst_port":     "22",
+				"_protocol":     "6",
+				"_bytes":        "4249",
+				"_end":          "1418530070",
+				"_action":       "ACCEPT",
+			}},
+		{`2 123456789010 eni-1235b8ca123456789 - - - - - - - 1431280876 1431280934 - NODATA`,
+			map[string]string{"_src_ip": "<none>", "_log-status": "NODATA"}},
+
+		// A header line in a log delivered to S3 replaces the columns
+		{`version vpc-id subnet-id instance-id srcaddr dstaddr pkt-srcaddr pkt-dstaddr start end action`, nil},
+		{`3 vpc-7f2a subnet-aaaaaaaa012345678 i-01234567890123456 10.40.1.175 10.40.2.236 10.20.33.164 10.40.2.236 1592337850 1592337899 ACCEPT`,
+			map[string]string{"_vpc_id": "vpc-7f2a", "_instance_id": "i-01234567890123456", "_pkt_src_ip": "10.20.33.164", "_dst_ip": "10.40.2.236", "timestamp": "1592337850"}},
+	})
+}
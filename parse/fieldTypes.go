@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+// Field types that can be used in field definitions
+var fieldTypes = map[string]bool{
+	"": true, "string": true, "int": true, "float": true, "bool": true, "ip": true, "duration": true,
+	"date": true, "rfc3339": true, "epoch_s": true, "epoch_ms": true, "epoch_us": true,
+	"list": true, "intlist": true, "floatlist": true,
+}
+
+// Named layouts that can be used as the DateFormat of a date field
+var dateLayouts = map[string]string{
+	"rfc3339":     time.RFC3339Nano,
+	"iso8601":     "2006-01-02T15:04:05Z07:00",
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"rfc850":      time.RFC850,
+	"ansic":       time.ANSIC,
+	"unixdate":    time.UnixDate,
+	"rubydate":    time.RubyDate,
+	"syslog":      time.Stamp,
+	"datetime":    "2006-01-02 15:04:05",
+	"apache":      "02/Jan/2006:15:04:05 -0700",
+	"apacheerror": "Mon Jan 02 15:04:05.000000 2006",
+	"nginxerror":  "2006/01/02 15:04:05",
+}
+
+// Duration units in addition to those understood by time.ParseDuration
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "nsec": time.Nanosecond,
+	"us": time.Microsecond, "µs": time.Microsecond, "usec": time.Microsecond,
+	"ms": time.Millisecond, "msec": time.Millisecond, "msecs": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+}
+
+// checkField returns an error if the type or error policy of a field definition is unknown
+func checkField(name string, f config.RegexField) error {
+	if !fieldTypes[f.FType] {
+		return errors.New(fmt.Sprintf("unknown type %s for field %s", f.FType, name))
+	}
+
+	switch strings.ToLower(f.OnError) {
+	case "", "drop", "raw", "fail":
+	default:
+		return errors.New(fmt.Sprintf("unknown OnError %s for field %s", f.OnError, name))
+	}
+	return nil
+}
+
+// fieldOnError returns what to do when a value can not be converted: drop the field, keep the
+// raw string or fail the line. Lines with invalid dates fail by default, other fields are dropped.
+func fieldOnError(f config.RegexField) string {
+	if f.OnError != "" {
+		return strings.ToLower(f.OnError)
+	}
+
+	switch f.FType {
+	case "date", "rfc3339", "epoch_s", "epoch_ms", "epoch_us":
+		return "fail"
+	}
+	return "drop"
+}
+
+// parseDate returns the GELF timestamp of a date in the given layout or named layout. Dates without a
+// time zone, and dates that AddTZ pretends are in UTC, are in the location, or UTC if it is nil.
+// Dates without a year are in the last 12 months.
+func parseDate(value string, format string, addTZ bool, loc *time.Location) (float64, error) {
+	layout := format
+	if l, ok := dateLayouts[strings.ToLower(format)]; ok {
+		layout = l
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	tmp := value
+	if addTZ {
+		tmp = tmp + " +0000"
+	}
+	t, err := time.ParseInLocation(layout, tmp, loc)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("unable to parse date %s using format %s: %s", value, format, err.Error()))
+	}
+
+	// Replace the zone added for the layout with the location
+	if addTZ && loc != time.UTC {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+
+	// Formats such as the syslog timestamp do not include the year, so the date is taken to be
+	// in the last 12 months. A date more than a day ahead is from the previous year.
+	if t.Year() == 0 {
+		t = t.AddDate(time.Now().In(loc).Year(), 0, 0)
+		if t.After(time.Now().Add(24 * time.Hour)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+	}
+	return global.UnixTime(t), nil
+}
+
+// parseEpoch returns the time in seconds of an epoch time in seconds, milliseconds or microseconds
+func parseEpoch(value string, fType string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid epoch time %s", value))
+	}
+
+	switch fType {
+	case "epoch_ms":
+		f = f / 1e3
+	case "epoch_us":
+		f = f / 1e6
+	}
+	return f, nil
+}
+
+// parseBool returns the boolean value of true/false, yes/no, on/off, 1/0 and their abbreviations
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "t", "yes", "y", "on", "1":
+		return true, nil
+	case "false", "f", "no", "n", "off", "0":
+		return false, nil
+	}
+	return false, errors.New(fmt.Sprintf("invalid boolean %s", value))
+}
+
+// parseIP returns a validated IP address, which may be in brackets or include an IPv6 zone
+func parseIP(value string) (net.IP, error) {
+	s := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "["), "]")
+	if i := strings.Index(s, "%"); i > 0 {
+		s = s[:i]
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, errors.New(fmt.Sprintf("invalid IP address %s", value))
+	}
+	return ip, nil
+}
+
+// ipFamily returns ipv4 or ipv6
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// parseDuration returns a duration in seconds. Go durations such as 1m30s and numbers with a
+// unit such as "12 ms" or "1.5sec" are accepted, and numbers without a unit are seconds.
+func parseDuration(value string) (float64, error) {
+	s := strings.TrimSpace(value)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), nil
+	}
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid duration %s", value))
+	}
+
+	unit := strings.ToLower(strings.TrimSpace(s[i:]))
+	if unit == "" {
+		return n, nil
+	}
+	d, ok := durationUnits[unit]
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("invalid duration unit %s", value))
+	}
+	return n * d.Seconds(), nil
+}
@@ -0,0 +1,228 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+func TestParseDate(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		value  string
+		format string
+		addTZ  bool
+		loc    *time.Location
+		want   float64
+	}{
+		{"11/Oct/2023:22:14:15 +0200", "apache", false, nil, 1697055255},
+		{"2023-10-11T22:14:15.123456Z", "rfc3339", false, nil, 1697062455.123456},
+		{"2023-10-11 22:14:15", "datetime", false, nil, 1697062455},
+		{"2023-10-11 22:14:15", "datetime", false, ny, 1697076855},
+		{"Wed Oct 11 22:14:15.654321 2023", "Mon Jan 02 15:04:05.000000 2006 -0700", true, nil, 1697062455.654321},
+		{"Wed Oct 11 22:14:15.654321 2023", "Mon Jan 02 15:04:05.000000 2006 -0700", true, ny, 1697076855.654321},
+		{"2023/10/11 22:14:15", "nginxerror", false, nil, 1697062455},
+	}
+	for _, tt := range tests {
+		got, err := parseDate(tt.value, tt.format, tt.addTZ, tt.loc)
+		if err != nil {
+			t.Errorf("parseDate(%q, %s): %s", tt.value, tt.format, err)
+			continue
+		}
+		if fmt.Sprintf("%.6f", got) != fmt.Sprintf("%.6f", tt.want) {
+			t.Errorf("parseDate(%q, %s) = %.6f, want %.6f", tt.value, tt.format, got, tt.want)
+		}
+	}
+
+	if _, err := parseDate("not a date", "datetime", false, nil); err == nil {
+		t.Error("parseDate(not a date) succeeded")
+	}
+}
+
+func TestParseDateWithoutYear(t *testing.T) {
+	now := time.Now().UTC()
+
+	// A date from yesterday is in this year unless that was last year
+	yesterday := now.Add(-24 * time.Hour)
+	got, err := parseDate(yesterday.Format(time.Stamp), "syslog", false, nil)
+	if err != nil {
+		t.Fatalf("parseDate: %s", err)
+	}
+	if want := global.UnixTime(yesterday.Truncate(time.Second)); got != want {
+		t.Errorf("parseDate(yesterday) = %f, want %f", got, want)
+	}
+
+	// A date more than a day ahead, such as Dec 31 read on Jan 1, is from last year
+	ahead := now.Add(72 * time.Hour)
+	got, err = parseDate(ahead.Format(time.Stamp), "syslog", false, nil)
+	if err != nil {
+		t.Fatalf("parseDate: %s", err)
+	}
+	if want := global.UnixTime(ahead.Truncate(time.Second).AddDate(-1, 0, 0)); got != want {
+		t.Errorf("parseDate(3 days ahead) = %f, want %f", got, want)
+	}
+}
+
+func TestParseEpoch(t *testing.T) {
+	tests := []struct {
+		value string
+		fType string
+		want  string
+	}{
+		{"1697000000", "epoch_s", "1697000000.000000"},
+		{"1697000000.123456", "epoch_s", "1697000000.123456"},
+		{"1697000000123", "epoch_ms", "1697000000.123000"},
+		{"1697000000123456", "epoch_us", "1697000000.123456"},
+	}
+	for _, tt := range tests {
+		got, err := parseEpoch(tt.value, tt.fType)
+		if err != nil {
+			t.Errorf("parseEpoch(%s, %s): %s", tt.value, tt.fType, err)
+			continue
+		}
+		if s := fmt.Sprintf("%.6f", got); s != tt.want {
+			t.Errorf("parseEpoch(%s, %s) = %s, want %s", tt.value, tt.fType, s, tt.want)
+		}
+	}
+	if _, err := parseEpoch("soon", "epoch_s"); err == nil {
+		t.Error("parseEpoch(soon) succeeded")
+	}
+}
+
+func TestAddField(t *testing.T) {
+	tests := []struct {
+		field config.RegexField
+		value string
+		want  string // printed value, "<none>" if the field is dropped or "<fail>" if the line fails
+	}{
+		{config.RegexField{FType: "int"}, " 42 ", "42"},
+		{config.RegexField{FType: "int"}, "4x", "<none>"},
+		{config.RegexField{FType: "int", OnError: "raw"}, "4x", "4x"},
+		{config.RegexField{FType: "int", OnError: "fail"}, "4x", "<fail>"},
+		{config.RegexField{FType: "float"}, "0.125", "0.125"},
+		{config.RegexField{FType: "bool"}, "Yes", "true"},
+		{config.RegexField{FType: "bool"}, "off", "false"},
+		{config.RegexField{FType: "bool"}, "maybe", "<none>"},
+		{config.RegexField{FType: "ip"}, "[2001:db8::1]", "2001:db8::1"},
+		{config.RegexField{FType: "ip"}, "fe80::1%eth0", "fe80::1"},
+		{config.RegexField{FType: "ip"}, "::ffff:10.0.0.1", "10.0.0.1"},
+		{config.RegexField{FType: "ip"}, "10.0.0.256", "<none>"},
+		{config.RegexField{FType: "duration"}, "1m30s", "90"},
+		{config.RegexField{FType: "duration"}, "12 ms", "0.012"},
+		{config.RegexField{FType: "duration"}, "1.5sec", "1.5"},
+		{config.RegexField{FType: "duration"}, "2", "2"},
+		{config.RegexField{FType: "duration"}, "2 fortnights", "<none>"},
+		{config.RegexField{FType: "rfc3339"}, "2023-10-11T22:14:15.123456Z", "1697062455.123456"},
+		{config.RegexField{FType: "rfc3339"}, "2023-10-11 22:14:15", "<fail>"},
+		{config.RegexField{FType: "rfc3339", OnError: "drop"}, "2023-10-11 22:14:15", "<none>"},
+		{config.RegexField{FType: "epoch_ms"}, "1697062455123", "1697062455.123"},
+		{config.RegexField{FType: "epoch_s"}, "soon", "<fail>"},
+		{config.RegexField{FType: "date", DateFormat: "iso8601"}, "2023-10-11T22:14:15+02:00", "1697055255"},
+		{config.RegexField{FType: "string"}, "  ", "-"},
+		{config.RegexField{}, "value", "value"},
+	}
+	for _, tt := range tests {
+		tt.field.Field = "_f"
+		g := GELFMessage{}
+		err := addField(g, tt.field, tt.value, nil)
+		if tt.want == "<fail>" {
+			if err == nil {
+				t.Errorf("addField(%s, %q) = %v, want error", tt.field.FType, tt.value, g["_f"])
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("addField(%s, %q): %s", tt.field.FType, tt.value, err)
+			continue
+		}
+		v, ok := g["_f"]
+		got := fieldString(v)
+		if !ok {
+			got = "<none>"
+		}
+		if got != tt.want {
+			t.Errorf("addField(%s %s, %q) = %s, want %s", tt.field.FType, tt.field.OnError, tt.value, got, tt.want)
+		}
+	}
+
+	// IP fields also record the address family
+	g := GELFMessage{}
+	if err := addField(g, config.RegexField{Field: "_src", FType: "ip"}, "2001:db8::1", nil); err != nil || g["_src_family"] != "ipv6" {
+		t.Errorf("_src_family = %v, %v, want ipv6", g["_src_family"], err)
+	}
+
+	// A short message is kept even if the field is dropped
+	g = GELFMessage{}
+	_ = addField(g, config.RegexField{Field: "_n", FType: "int", ShortMessage: true}, "n/a", nil)
+	if g["short_message"] != "n/a" {
+		t.Errorf("short_message = %v, want the raw value", g["short_message"])
+	}
+}
+
+func TestCheckField(t *testing.T) {
+	tests := []struct {
+		field config.RegexField
+		ok    bool
+	}{
+		{config.RegexField{FType: "intlist"}, true},
+		{config.RegexField{FType: "epoch_us", OnError: "RAW"}, true},
+		{config.RegexField{FType: "integer"}, false},
+		{config.RegexField{FType: "int", OnError: "ignore"}, false},
+	}
+	for _, tt := range tests {
+		if err := checkField("f", tt.field); (err == nil) != tt.ok {
+			t.Errorf("checkField(%+v) = %v", tt.field, err)
+		}
+	}
+}
+
+func TestSetLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		format string
+		line   string
+		want   string
+	}{
+		// Dates without a zone are in the location
+		{formatNginxError, `2023/10/11 22:14:15 [error] 1234#5678: failed`, "1697076855"},
+		{formatApacheError, `[Wed Oct 11 22:14:15.000250 2023] [core:error] [pid 1234] failed`, "1697076855.00025"},
+		// Dates with a zone, and W3C dates which are always in UTC, are not changed
+		{formatW3C, "#Fields: date time c-ip\n2023-10-11 22:14:15 10.0.0.1", "1697062455"},
+		{formatApacheCombined, `10.0.0.1 - - [11/Oct/2023:22:14:15 +0000] "GET / HTTP/1.1" 200 512 "-" "curl/8.0"`, "1697062455"},
+	}
+	for _, tt := range tests {
+		p, err := NewChain(tt.format, []string{formatJSON})
+		if err != nil {
+			t.Fatalf("NewChain(%s): %s", tt.format, err)
+		}
+		p.SetLocation(ny)
+
+		var g GELFMessage
+		for _, line := range strings.Split(tt.line, "\n") {
+			g, err = p.Parse(line)
+		}
+		if err != nil {
+			t.Errorf("%s: Parse: %s", tt.format, err)
+			continue
+		}
+		if got := fieldString(g["timestamp"]); got != tt.want {
+			t.Errorf("%s: timestamp = %s, want %s", tt.format, got, tt.want)
+		}
+	}
+}
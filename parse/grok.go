@@ -0,0 +1,199 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"log2sqs/config"
+)
+
+// Maximum depth of nested pattern references
+const grokMaxDepth = 50
+
+// Matches %{PATTERN}, %{PATTERN:field} or %{PATTERN:field:type}
+var grokRegex = regexp.MustCompile(`%\{(\w+)(?::([^:}]+))?(?::(\w+))?\}`)
+
+// Matches Oniguruma-style named groups, (?<name>...), which Go writes as (?P<name>...)
+var grokNamedGroupRegex = regexp.MustCompile(`\(\?<(\w+)>`)
+
+// grokCompiler holds the state used while expanding a grok expression
+type grokCompiler struct {
+	patterns  map[string]string
+	overrides map[string]config.RegexField
+	fields    map[string]config.RegexField
+}
+
+// CompileGrok expands a grok expression, such as %{IP:client} %{NUMBER:bytes:int}, into a regex
+// with named groups. It returns the regex and the field definition for each group. Patterns
+// supplements or replaces the built-in pattern library, and overrides replaces the generated
+// definition for a grok field name.
+func CompileGrok(expr string, patterns map[string]string, overrides map[string]config.RegexField) (string, map[string]config.RegexField, error) {
+	c := grokCompiler{
+		patterns:  make(map[string]string),
+		overrides: overrides,
+		fields:    make(map[string]config.RegexField),
+	}
+
+	for k, v := range grokPatterns {
+		c.patterns[k] = v
+	}
+	for k, v := range patterns {
+		c.patterns[k] = v
+	}
+
+	regex, err := c.expand(expr, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return regex, c.fields, nil
+}
+
+// expand replaces the pattern references in s
+func (c *grokCompiler) expand(s string, depth int) (string, error) {
+	if depth > grokMaxDepth {
+		return "", errors.New("grok patterns nested too deeply")
+	}
+
+	s = grokNamedGroupRegex.ReplaceAllString(s, "(?P<$1>")
+
+	var err error
+	result := grokRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+
+		m := grokRegex.FindStringSubmatch(ref)
+		pattern, ok := c.patterns[m[1]]
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern %s", m[1])
+			return ""
+		}
+
+		var sub string
+		sub, err = c.expand(pattern, depth+1)
+		if err != nil {
+			return ""
+		}
+
+		// Patterns without a field name are not captured
+		if m[2] == "" {
+			return "(?:" + sub + ")"
+		}
+
+		var group string
+		group, err = c.addField(m[1], m[2], m[3])
+		return "(?P<" + group + ">" + sub + ")"
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// addField records the field for a captured pattern and returns the group name
+func (c *grokCompiler) addField(pattern string, name string, fType string) (string, error) {
+	group := fmt.Sprintf("g%d", len(c.fields)+1)
+
+	if f, ok := c.overrides[name]; ok {
+		if f.Field == "" {
+			f.Field = captureFieldName(name)
+		}
+		if f.FType == "" {
+			f.FType = "string"
+		}
+		c.fields[group] = f
+		return group, nil
+	}
+
+	f := config.RegexField{Field: captureFieldName(name), FType: "string"}
+
+	switch strings.ToLower(fType) {
+	case "", "string":
+	case "int", "long":
+		f.FType = "int"
+	case "float", "double":
+		f.FType = "float"
+	default:
+		if !fieldTypes[strings.ToLower(fType)] {
+			return "", fmt.Errorf("unsupported grok type %s for field %s", fType, name)
+		}
+		f.FType = strings.ToLower(fType)
+	}
+
+	// GELF timestamps are numeric, so keep the text in another field unless the layout is known
+	if f.Field == "timestamp" && fType == "" {
+		if layout, ok := grokDateFormats[pattern]; ok {
+			f.FType = "date"
+			f.DateFormat = layout
+		} else {
+			f.Field = "_timestamp"
+		}
+	}
+
+	c.fields[group] = f
+	return group, nil
+}
+
+// LoadGrokPatterns reads pattern definitions from the files in a directory. Each line contains
+// a pattern name followed by whitespace and the pattern. Blank lines and comments are ignored.
+func LoadGrokPatterns(dir string) (map[string]string, error) {
+	patterns := make(map[string]string)
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range files {
+		if entry.IsDir() {
+			continue
+		}
+
+		err = loadGrokFile(filepath.Join(dir, entry.Name()), patterns)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+// loadGrokFile reads the pattern definitions in a file
+func loadGrokFile(name string, patterns map[string]string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(s, " ", 2)
+		if len(fields) != 2 {
+			fields = strings.SplitN(s, "\t", 2)
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s line %d: invalid pattern definition", name, line)
+		}
+		patterns[fields[0]] = strings.TrimSpace(fields[1])
+	}
+	return scanner.Err()
+}
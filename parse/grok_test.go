@@ -0,0 +1,120 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"log2sqs/config"
+)
+
+// addTestParser resets the configuration, adds the custom parser and returns a new instance of it
+func addTestParser(t *testing.T, cp config.CustomParser) *Parser {
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.CustomParsers = []config.CustomParser{cp}
+
+	err := AddCustomParsers()
+	if err != nil {
+		t.Fatalf("AddCustomParsers: %s", err)
+	}
+	p, err := New(cp.Name)
+	if err != nil {
+		t.Fatalf("New(%s): %s", cp.Name, err)
+	}
+	return p
+}
+
+func TestGrokApache(t *testing.T) {
+	p := addTestParser(t, config.CustomParser{Name: "test_grok_apache", Type: "grok", Pattern: `^%{COMBINEDAPACHELOG}$`})
+
+	checkParser(t, p, []parseTest{
+		{`198.51.100.4 - frank [11/Oct/2023:22:14:15 +0000] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			map[string]string{
+				"_clientip":    "198.51.100.4",
+				"_auth":        "frank",
+				"timestamp":    "1697062455",
+				"_verb":        "GET",
+				"_request":     "/apache_pb.gif",
+				"_httpversion": "1.0",
+				"_response":    "200",
+				"_bytes":       "2326",
+				"_referrer":    `"http://www.example.com/start.html"`,
+				"_rawrequest":  "<none>",
+			}},
+		// Optional groups that did not match are omitted
+		{`2001:db8::1 - - [11/Oct/2023:22:14:15 +0000] "-" 408 - "-" "-"`,
+			map[string]string{"_clientip": "2001:db8::1", "_rawrequest": "-", "_response": "408", "_bytes": "<none>", "_verb": "<none>"}},
+		{`198.51.100.4 - frank [11/Oct/2023:22:14:15 +0000] "GET /apache_pb.gif HTTP/1.0" 200`, nil},
+	})
+}
+
+func TestGrokSyslog(t *testing.T) {
+	p := addTestParser(t, config.CustomParser{Name: "test_grok_syslog", Type: "grok", Pattern: `%{SYSLOGLINE}`})
+
+	checkParser(t, p, []parseTest{
+		{`Oct  1 22:14:15 web1 sshd[4321]: Accepted publickey for root from 10.0.0.1 port 51234 ssh2`,
+			map[string]string{"_logsource": "web1", "_program": "sshd", "_pid": "4321", "short_message": "Accepted publickey for root from 10.0.0.1 port 51234 ssh2"}},
+		{`Oct 11 22:14:15 web1 kernel: eth0: link up`,
+			map[string]string{"_program": "kernel", "_pid": "<none>", "short_message": "eth0: link up"}},
+		{`web1 kernel: no timestamp`, nil},
+	})
+}
+
+func TestGrokCustomPatterns(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "app"), []byte("# application patterns\n\nAPPLEVEL\t(?:TRACE|DEBUG|INFO|WARN|ERROR)\nREQID req-%{BASE16NUM}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := addTestParser(t, config.CustomParser{
+		Name:        "test_grok_app",
+		Type:        "grok",
+		Pattern:     `^%{TIMESTAMP_ISO8601:timestamp} %{APPLEVEL:level} %{REQID:request_id} %{DURMS:elapsed:float}ms (?<message>.*)$`,
+		PatternsDir: dir,
+		Patterns:    map[string]string{"DURMS": `%{NUMBER}`},
+		Fields:      map[string]config.RegexField{"level": {Field: "_severity"}},
+	})
+
+	checkParser(t, p, []parseTest{
+		{`2023-10-11T22:14:15.250Z WARN req-3f2a 12.5ms cache miss for key user:42`,
+			map[string]string{
+				"timestamp":     "1697062455.25",
+				"_severity":     "WARN",
+				"_request_id":   "req-3f2a",
+				"_elapsed":      "12.5",
+				"short_message": "cache miss for key user:42",
+			}},
+		{`2023-10-11T22:14:15Z VERBOSE req-1 1ms text`, nil},
+	})
+}
+
+func TestCompileGrokErrors(t *testing.T) {
+	tests := []struct {
+		expr     string
+		patterns map[string]string
+	}{
+		{`%{NOSUCHPATTERN:x}`, nil},
+		{`%{IP:client:ipaddress}`, nil},
+		{`%{LOOP}`, map[string]string{"LOOP": `a%{LOOP}`}},
+	}
+	for _, tt := range tests {
+		if _, _, err := CompileGrok(tt.expr, tt.patterns, nil); err == nil {
+			t.Errorf("CompileGrok(%q) succeeded", tt.expr)
+		}
+	}
+
+	// A timestamp in an unknown layout is kept as text
+	_, fields, err := CompileGrok(`%{NOTSPACE:timestamp}`, nil, nil)
+	if err != nil {
+		t.Fatalf("CompileGrok: %s", err)
+	}
+	if f := fields["g1"]; f.Field != "_timestamp" || f.FType != "string" {
+		t.Errorf("timestamp field = %+v, want a _timestamp string", f)
+	}
+}
@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"log2sqs/config"
+)
+
+// Regex for nginx variables that hold lists of values, such as "0.004, 0.002 : 0.010"
+const regexNginxList = `(\S+(?:(?:, | : )\S+)*)`
+
+// nginxVariable describes how to capture an nginx log_format variable
+type nginxVariable struct {
+	field      string
+	fType      string
+	dateFormat string
+	regex      string // overrides the default regex for the variable
+	short      bool   // use as the short_message
+}
+
+// Variables with established field names and types. Other variables are captured as strings.
+var nginxVariables = map[string]nginxVariable{
+	"remote_addr":              {field: "_src_ip", fType: "string"},
+	"remote_user":              {field: "_user", fType: "string"},
+	"remote_port":              {field: "_remote_port", fType: "int"},
+	"realip_remote_addr":       {field: "_realip_remote_addr", fType: "string"},
+	"time_local":               {field: "timestamp", fType: "date", dateFormat: "02/Jan/2006:15:04:05 -0700", regex: `(\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})`},
+	"time_iso8601":             {field: "timestamp", fType: "date", dateFormat: "2006-01-02T15:04:05-07:00"},
+	"msec":                     {field: "timestamp", fType: "float"},
+	"request":                  {field: "_http_request", fType: "string", short: true},
+	"request_method":           {field: "_http_request_method", fType: "string"},
+	"request_uri":              {field: "_http_request_uri", fType: "string"},
+	"uri":                      {field: "_http_request_path", fType: "string"},
+	"document_uri":             {field: "_http_request_path", fType: "string"},
+	"args":                     {field: "_http_request_query", fType: "string"},
+	"query_string":             {field: "_http_request_query", fType: "string"},
+	"server_protocol":          {field: "_http_protocol", fType: "string"},
+	"scheme":                   {field: "_http_scheme", fType: "string"},
+	"host":                     {field: "_http_host", fType: "string"},
+	"server_name":              {field: "_server_name", fType: "string"},
+	"server_addr":              {field: "_local_ip", fType: "string"},
+	"server_port":              {field: "_server_port", fType: "int"},
+	"status":                   {field: "_http_status", fType: "int"},
+	"body_bytes_sent":          {field: "_http_response_size", fType: "int"},
+	"bytes_sent":               {field: "_bytes_sent", fType: "int"},
+	"request_length":           {field: "_request_length", fType: "int"},
+	"request_time":             {field: "_request_time", fType: "float"},
+	"connection":               {field: "_connection", fType: "int"},
+	"connection_requests":      {field: "_connection_requests", fType: "int"},
+	"pid":                      {field: "_pid", fType: "int"},
+	"gzip_ratio":               {field: "_gzip_ratio", fType: "float"},
+	"http_referer":             {field: "_http_referer", fType: "string"},
+	"http_user_agent":          {field: "_user_agent", fType: "string"},
+	"http_x_forwarded_for":     {field: "_x-forwarded-for", fType: "list", regex: regexNginxList},
+	"http_x_forwarded_proto":   {field: "_x-forwarded-proto", fType: "string"},
+	"http_x_forwarded_port":    {field: "_x-forwarded-port", fType: "string"},
+	"upstream_addr":            {field: "_upstream_addr", fType: "list", regex: regexNginxList},
+	"upstream_status":          {field: "_upstream_status", fType: "intlist", regex: regexNginxList},
+	"upstream_response_time":   {field: "_upstream_response_time", fType: "floatlist", regex: regexNginxList},
+	"upstream_connect_time":    {field: "_upstream_connect_time", fType: "floatlist", regex: regexNginxList},
+	"upstream_header_time":     {field: "_upstream_header_time", fType: "floatlist", regex: regexNginxList},
+	"upstream_response_length": {field: "_upstream_response_length", fType: "intlist", regex: regexNginxList},
+	"upstream_bytes_received":  {field: "_upstream_bytes_received", fType: "intlist", regex: regexNginxList},
+	"upstream_bytes_sent":      {field: "_upstream_bytes_sent", fType: "intlist", regex: regexNginxList},
+	"upstream_cache_status":    {field: "_upstream_cache_status", fType: "string"},
+}
+
+// Matches $name or ${name}
+var nginxVariableRegex = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+
+// Matches a complete nginx log_format directive
+var nginxConfigLineRegex = regexp.MustCompile(`^\s*log_format\s+\S+\s+(?:escape=\S+\s+)?`)
+
+// Matches the quoted strings that make up the format in an nginx log_format directive
+var nginxQuotedRegex = regexp.MustCompile(`'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)"`)
+
+// CompileNginxLogFormat converts an nginx log_format string, such as
+// $remote_addr - $remote_user [$time_local] "$request", into the equivalent numbered regex fields
+func CompileNginxLogFormat(format string) (config.RegexFields, error) {
+
+	// Accept a log_format directive copied from the nginx configuration, which may
+	// be split into several quoted strings
+	if loc := nginxConfigLineRegex.FindStringIndex(format); loc != nil {
+		tmp := ""
+		for _, m := range nginxQuotedRegex.FindAllStringSubmatch(format[loc[1]:], -1) {
+			tmp = tmp + m[1] + m[2]
+		}
+		format = tmp
+	}
+
+	fields := config.RegexFields{}
+	used := map[string]int{}
+	literal := ""
+	quoted := false
+	pos := 0
+
+	for _, loc := range nginxVariableRegex.FindAllStringSubmatchIndex(format, -1) {
+		literal = literal + format[pos:loc[0]]
+		pos = loc[1]
+
+		name := ""
+		if loc[2] >= 0 {
+			name = format[loc[2]:loc[3]]
+		} else {
+			name = format[loc[4]:loc[5]]
+		}
+		v := nginxVariableFor(name)
+
+		// Quotes in the literal text determine whether the variable is quoted
+		if strings.Count(literal, `"`)%2 == 1 {
+			quoted = !quoted
+		}
+
+		regex := v.regex
+		if quoted {
+			regex = regexQuoted
+		} else if regex == "" {
+			regex = regexToken
+		}
+
+		// Avoid overwriting a field that appears more than once
+		used[v.field]++
+		if used[v.field] > 1 {
+			v.field = fmt.Sprintf("%s_%d", v.field, used[v.field])
+		}
+
+		prefix := regexp.QuoteMeta(literal)
+		if len(fields) == 0 {
+			prefix = "^" + prefix
+		}
+
+		fields[len(fields)+1] = config.RegexField{
+			Regex:        prefix + regex,
+			Field:        v.field,
+			FType:        v.fType,
+			DateFormat:   v.dateFormat,
+			ShortMessage: v.short,
+		}
+		literal = ""
+	}
+
+	if len(fields) == 0 {
+		return nil, errors.New("log_format contains no variables")
+	}
+
+	// Add any trailing literal text to the last field
+	literal = literal + format[pos:]
+	last := fields[len(fields)]
+	last.Regex = last.Regex + regexp.QuoteMeta(literal) + "$"
+	fields[len(fields)] = last
+
+	return fields, nil
+}
+
+// nginxVariableFor returns the field definition for a variable name
+func nginxVariableFor(name string) nginxVariable {
+	if v, ok := nginxVariables[name]; ok {
+		return v
+	}
+
+	switch {
+	case strings.HasPrefix(name, "http_"):
+		return nginxVariable{field: "_http_" + strings.TrimPrefix(name, "http_"), fType: "string"}
+	case strings.HasPrefix(name, "sent_http_"):
+		return nginxVariable{field: "_http_response_" + strings.TrimPrefix(name, "sent_http_"), fType: "string"}
+	case strings.HasPrefix(name, "upstream_http_"):
+		return nginxVariable{field: "_upstream_http_" + strings.TrimPrefix(name, "upstream_http_"), fType: "list", regex: regexNginxList}
+	default:
+		return nginxVariable{field: "_" + name, fType: "string"}
+	}
+}
+
+// mustCompileNginxLogFormat compiles a built-in format and panics on error
+func mustCompileNginxLogFormat(format string) config.RegexFields {
+	fields, err := CompileNginxLogFormat(format)
+	if err != nil {
+		panic(err)
+	}
+	return fields
+}
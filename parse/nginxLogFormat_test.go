@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNginxLogFormat(t *testing.T) {
+	p := addTestRegexParser(t, "test_nginx", CompileNginxLogFormat,
+		`log_format upstream '$remote_addr - $remote_user [$time_local] "$request" '
+		                     '$status $body_bytes_sent $request_time '
+		                     'upstream=$upstream_addr ustatus=$upstream_status urt=$upstream_response_time';`)
+
+	checkParser(t, p, []parseTest{
+		{`10.1.2.3 - - [11/Oct/2023:22:14:15 +0000] "GET /api/v1/items HTTP/2.0" 200 512 0.012 upstream=10.0.0.1:8080 ustatus=200 urt=0.010`,
+			map[string]string{
+				"_src_ip":                      "10.1.2.3",
+				"timestamp":                    "1697062455",
+				"short_message":                "GET /api/v1/items HTTP/2.0",
+				"_http_status":                 "200",
+				"_http_response_size":          "512",
+				"_request_time":                "0.012",
+				"_upstream_addr":               "10.0.0.1:8080",
+				"_upstream_status":             "200",
+				"_upstream_response_time_last": "0.01",
+			}},
+		// Retried upstreams and an internal redirect
+		{`10.1.2.3 - bob [11/Oct/2023:22:14:15 +0000] "POST /upload HTTP/1.1" 200 0 1.503 upstream=10.0.0.1:8080, 10.0.0.2:8080 : 10.0.0.3:8080 ustatus=502, 504 : 200 urt=0.500, 0.501 : 0.400`,
+			map[string]string{
+				"_user":                        "bob",
+				"_upstream_addr":               "10.0.0.1:8080,10.0.0.2:8080,10.0.0.3:8080",
+				"_upstream_status":             "502,504,200",
+				"_upstream_status_last":        "200",
+				"_upstream_response_time_last": "0.4",
+			}},
+		// No upstream was contacted
+		{`10.1.2.3 - - [11/Oct/2023:22:14:15 +0000] "GET /health HTTP/1.1" 204 0 0.000 upstream=- ustatus=- urt=-`,
+			map[string]string{"_upstream_addr": "-", "_http_status": "204"}},
+		{`10.1.2.3 - - [11/Oct/2023:22:14:15 +0000] "GET /api/v1/items HTTP/2.0" 200 512`, nil},
+	})
+}
+
+func TestNginxLogFormatFields(t *testing.T) {
+	tests := []struct {
+		format string
+		fields []string // field names in order, or nil if the format should not compile
+	}{
+		{`$remote_addr [$time_iso8601] "$request"`, []string{"_src_ip", "timestamp", "_http_request"}},
+		{`${host}:${server_port} $http_x_request_id $sent_http_content_type $upstream_http_x_cache`, []string{"_http_host", "_server_port", "_http_x_request_id", "_http_response_content_type", "_upstream_http_x_cache"}},
+		{`$status $status $ssl_protocol`, []string{"_http_status", "_http_status_2", "_ssl_protocol"}},
+		{`log_format main escape=json '{"addr":"$remote_addr",' '"status":$status}';`, []string{"_src_ip", "_http_status"}},
+		{`no variables`, nil},
+	}
+	for _, tt := range tests {
+		fields, err := CompileNginxLogFormat(tt.format)
+		if tt.fields == nil {
+			if err == nil {
+				t.Errorf("CompileNginxLogFormat(%q) succeeded", tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("CompileNginxLogFormat(%q): %s", tt.format, err)
+			continue
+		}
+		var got []string
+		for i := 1; i <= len(fields); i++ {
+			got = append(got, fields[i].Field)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.fields) {
+			t.Errorf("CompileNginxLogFormat(%q) fields = %v, want %v", tt.format, got, tt.fields)
+		}
+	}
+}
+
+func TestNginxBuiltIn(t *testing.T) {
+	checkParser(t, testParser(t, formatNginxMain), []parseTest{
+		{`10.1.2.3 - - [11/Oct/2023:22:14:15 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.0" "203.0.113.9, 10.0.0.1"`,
+			map[string]string{"_src_ip": "10.1.2.3", "_http_status": "200", "_user_agent": "curl/8.0", "_x-forwarded-for": "203.0.113.9,10.0.0.1"}},
+		{`10.1.2.3 - - [11/Oct/2023:22:14:15 +0000] "GET / HTTP/1.1" 200 612 "-"`, nil},
+	})
+
+	checkParser(t, testParser(t, formatNginxError), []parseTest{
+		{`2023/10/11 22:14:15 [error] 1234#5678: *99 open() "/var/www/favicon.ico" failed (2: No such file or directory), client: 10.0.0.1`,
+			map[string]string{
+				"timestamp":     "1697062455",
+				"_nginx_level":  "error",
+				"_pid":          "1234",
+				"_tid":          "5678",
+				"_connection":   "99",
+				"short_message": `open() "/var/www/favicon.ico" failed (2: No such file or directory), client: 10.0.0.1`,
+			}},
+		{`2023/10/11 22:14:15 [notice] 1234#1234: signal process started`,
+			map[string]string{"_nginx_level": "notice", "short_message": "signal process started"}},
+		{`2023/10/11 22:14:15 [error]`, nil},
+	})
+}
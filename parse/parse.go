@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"time"
 
 	"log2sqs/config"
 )
@@ -17,10 +18,20 @@ const (
 	RegexParserType = iota
 	GelfParserType
 	PlainTextParserType
+	NamedRegexParserType
+	JSONParserType
+	LogfmtParserType
+	DelimitedParserType
+	AuditdParserType
+	ChainParserType
 )
 
 // CheckFormat checks if the format string is valid
 func CheckFormat(format string) bool {
+	if format == formatAuto {
+		return true
+	}
+
 	parsersMX.RLock()
 	defer parsersMX.RUnlock()
 
@@ -41,13 +52,20 @@ func New(format string) (*Parser, error) {
 
 	// Create a deep copy for thread safety
 	var parser = Parser{
-		format:        p.format,
-		parserType:    p.parserType,
-		requireFields: p.requireFields,
-		regexFields:   make(config.RegexFields),
-		regex:         nil,
+		format:           p.format,
+		parserType:       p.parserType,
+		requireFields:    p.requireFields,
+		regexFields:      make(config.RegexFields),
+		regex:            nil,
+		pattern:          p.pattern,
+		namedFields:      make(map[string]config.RegexField),
+		keyOptions:       p.keyOptions,
+		delimitedOptions: p.delimitedOptions,
 	}
 
+	// Columns change when header lines are read, so each instance needs its own copy
+	parser.delimitedOptions.columns = append([]string(nil), p.delimitedOptions.columns...)
+
 	if parser.parserType == RegexParserType {
 		// Copy the RegexFields map
 		for k, v := range p.regexFields {
@@ -69,9 +87,34 @@ func New(format string) (*Parser, error) {
 		parser.regex = r
 	}
 
+	if parser.parserType == NamedRegexParserType {
+		for k, v := range p.namedFields {
+			parser.namedFields[k] = v
+		}
+
+		r, err := regexp.Compile(parser.pattern)
+		if err != nil {
+			return &Parser{}, errors.New(fmt.Sprintf("Regex failed to compile: %s", err.Error()))
+		}
+		parser.regex = r
+	}
+
 	return &parser, nil
 }
 
+// SetLocation sets the time zone of dates that do not include one. By default, they are in UTC.
+func (p *Parser) SetLocation(loc *time.Location) {
+	p.location = loc
+	if p.chain != nil {
+		for _, cp := range p.chain.parsers {
+			cp.SetLocation(loc)
+		}
+		for _, a := range p.chain.sample {
+			a.parser.SetLocation(loc)
+		}
+	}
+}
+
 // Parse parses the line into a GELF message based on the format
 func (p *Parser) Parse(line string) (GELFMessage, error) {
 
@@ -83,6 +126,18 @@ func (p *Parser) Parse(line string) (GELFMessage, error) {
 		return p.gelfParser(line)
 	case PlainTextParserType:
 		return p.plainTextParser(line)
+	case NamedRegexParserType:
+		return p.namedRegexParser(line)
+	case JSONParserType:
+		return p.jsonParser(line)
+	case LogfmtParserType:
+		return p.logfmtParser(line)
+	case DelimitedParserType:
+		return p.delimitedParser(line)
+	case AuditdParserType:
+		return p.auditdParser(line)
+	case ChainParserType:
+		return p.chainParser(line)
 	default:
 		return GELFMessage{}, errors.New("unknown parser type")
 	}
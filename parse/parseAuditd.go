@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+// Matches the event ID in an audit record, msg=audit(1364481363.243:24287):
+var auditIDRegex = regexp.MustCompile(`msg=audit\((\d+(?:\.\d+)?):(\d+)\):\s*`)
+
+// Matches the start of an unquoted hex value. Values that are not hex encoded are quoted.
+var auditHexRegex = regexp.MustCompile(`(?:^|\s)(\w+)=([0-9A-Fa-f]+)`)
+
+// Fields that auditd hex encodes when they contain spaces, quotes or control characters
+var auditHexFields = map[string]bool{
+	"proctitle": true, "comm": true, "exe": true, "cwd": true, "name": true, "path": true, "cmd": true,
+	"acct": true, "data": true, "key": true, "ocomm": true, "dir": true, "file": true, "watch": true,
+	"root_dir": true, "vm": true,
+}
+
+// Fields used to summarize an event in the short message
+var auditSummaryFields = []string{"op", "key", "acct", "exe", "comm", "name", "success", "res"}
+
+// auditRecord is a single line of an audit event
+type auditRecord struct {
+	recordType string
+	fields     [][2]string
+}
+
+// auditEvent holds the records that share an event ID until the event is complete
+type auditEvent struct {
+	serial    string
+	timestamp float64
+	records   []auditRecord
+	received  time.Time
+}
+
+// auditdParser parses an auditd record. Records with the same serial number are grouped into a
+// single event, which is returned when its end of event (EOE) record is read. Records of
+// different events may be interleaved, so each incomplete event is held until its own EOE, and
+// ErrSkip is returned meanwhile. User space messages have no EOE and are returned at once.
+// Flush returns the events that are still incomplete after a timeout.
+func (p *Parser) auditdParser(s string) (GELFMessage, error) {
+	loc := auditIDRegex.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return GELFMessage{}, errors.New("not an audit record")
+	}
+	ts := string2Float(s[loc[2]:loc[3]])
+	serial := s[loc[4]:loc[5]]
+
+	// Enriched logs separate the interpreted fields with a group separator
+	s = strings.ReplaceAll(s, "\x1d", " ")
+
+	// User space messages contain their own key=value pairs in msg='...', which in enriched
+	// logs are followed by the interpreted fields
+	fields := s[:loc[0]] + " " + s[loc[1]:]
+	user := false
+	if i := strings.Index(fields, "msg='"); i >= 0 {
+		rest := fields[i+5:]
+		if j := strings.LastIndex(rest, "'"); j >= 0 {
+			rest = rest[:j] + rest[j+1:]
+		}
+		fields = fields[:i] + rest
+		user = true
+	}
+	fields = auditDecodeFields(fields)
+
+	r := auditRecord{}
+	for _, kv := range splitPairs(fields, "", "=") {
+		if kv[0] == "type" {
+			r.recordType = kv[1]
+			continue
+		}
+		r.fields = append(r.fields, kv)
+	}
+
+	if p.audit == nil {
+		p.audit = make(map[string]*auditEvent)
+	}
+	e, ok := p.audit[serial]
+
+	if r.recordType == "EOE" {
+		if !ok {
+			return GELFMessage{}, ErrSkip
+		}
+		delete(p.audit, serial)
+		return e.message(p.format), nil
+	}
+
+	if !ok {
+		e = &auditEvent{serial: serial, timestamp: ts, received: time.Now()}
+	}
+	e.records = append(e.records, r)
+
+	if user && !ok {
+		return e.message(p.format), nil
+	}
+	p.audit[serial] = e
+	return GELFMessage{}, ErrSkip
+}
+
+// Flush returns the oldest event that has been incomplete for longer than timeout. Callers
+// repeat it until it returns false. Parsers that do not group lines never have an incomplete
+// event.
+func (p *Parser) Flush(timeout time.Duration) (GELFMessage, bool) {
+	if p.chain != nil {
+		return p.chain.flush(timeout)
+	}
+
+	var oldest *auditEvent
+	for _, e := range p.audit {
+		if time.Since(e.received) >= timeout && (oldest == nil || e.received.Before(oldest.received)) {
+			oldest = e
+		}
+	}
+	if oldest == nil {
+		return GELFMessage{}, false
+	}
+
+	delete(p.audit, oldest.serial)
+	return oldest.message(p.format), true
+}
+
+// message converts the records of an event to a GELF message. Fields are named after the
+// record type, with an index if there is more than one record of the type.
+func (e *auditEvent) message(format string) GELFMessage {
+	g := GELFMessage{}
+	g["version"] = "1.1"
+	g["host"] = config.Config.Hostname
+	g["_original_format"] = format
+	g["timestamp"] = e.timestamp
+	g["_audit_serial"] = string2Int(e.serial)
+	g["level"] = global.INFO
+
+	counts := make(map[string]int)
+	for _, r := range e.records {
+		counts[r.recordType]++
+	}
+
+	seen := make(map[string]int)
+	var types []string
+	summary := make(map[string]string)
+
+	for _, r := range e.records {
+		prefix := "_audit_" + strings.ToLower(r.recordType)
+		if counts[r.recordType] > 1 {
+			prefix = fmt.Sprintf("%s_%d", prefix, seen[r.recordType])
+		}
+		seen[r.recordType]++
+		if seen[r.recordType] == 1 {
+			types = append(types, r.recordType)
+		}
+
+		for _, kv := range r.fields {
+			g[prefix+"_"+fieldNameRegex.ReplaceAllString(kv[0], "_")] = kv[1]
+			if _, ok := summary[kv[0]]; !ok {
+				summary[kv[0]] = kv[1]
+			}
+		}
+	}
+
+	g["_audit_types"] = strings.Join(types, ",")
+
+	// Failed operations are more interesting than the rest
+	if summary["success"] == "no" || strings.HasPrefix(summary["res"], "fail") {
+		g["level"] = global.WARN
+	}
+
+	msg := strings.Join(types, " ")
+	for _, k := range auditSummaryFields {
+		if v, ok := summary[k]; ok && v != "?" && v != "(null)" {
+			msg = msg + " " + k + "=" + v
+		}
+	}
+	g["short_message"] = emptyString(msg)
+	return g
+}
+
+// auditDecodeFields replaces the hex encoded values in the key=value pairs with the decoded,
+// quoted values
+func auditDecodeFields(s string) string {
+	var b strings.Builder
+	pos := 0
+	for _, m := range auditHexRegex.FindAllStringSubmatchIndex(s, -1) {
+
+		// The value must extend to the end of the pair
+		if m[1] < len(s) && !unicode.IsSpace(rune(s[m[1]])) {
+			continue
+		}
+		b.WriteString(s[pos:m[4]])
+		b.WriteString(auditDecode(s[m[2]:m[3]], s[m[4]:m[5]]))
+		pos = m[1]
+	}
+	b.WriteString(s[pos:])
+	return b.String()
+}
+
+// auditDecode returns the decoded, quoted value of a hex encoded field, or the value unchanged
+func auditDecode(key string, value string) string {
+	if !auditHexFields[strings.ToLower(key)] || len(value)%2 != 0 {
+		return value
+	}
+
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return value
+	}
+
+	// Arguments in the process title are separated by nulls
+	decoded := strings.TrimRight(strings.ReplaceAll(string(b), "\x00", " "), " ")
+	for _, c := range decoded {
+		if !unicode.IsPrint(c) && !unicode.IsSpace(c) {
+			return value
+		}
+	}
+
+	decoded = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(decoded)
+	return `"` + decoded + `"`
+}
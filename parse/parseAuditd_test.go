@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// checkAuditd parses each line, expecting ErrSkip if no fields are given
+func checkAuditd(t *testing.T, p *Parser, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		g, err := p.Parse(tt.in)
+		if tt.fields == nil {
+			if !errors.Is(err, ErrSkip) {
+				t.Errorf("Parse(%q) = %v, %v, want ErrSkip", tt.in, g, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.in, err)
+			continue
+		}
+		for k, want := range tt.fields {
+			if got := fieldString(g[k]); got != want {
+				t.Errorf("Parse(%q)[%s] = %q, want %q", tt.in, k, got, want)
+			}
+		}
+	}
+}
+
+func TestAuditdInterleaved(t *testing.T) {
+	p := testParser(t, formatAuditd)
+
+	checkAuditd(t, p, []parseTest{
+		{`type=SYSCALL msg=audit(1697062455.123:100): arch=c000003e syscall=2 success=no exit=-13 a0=7ffd comm="cat" exe="/usr/bin/cat" key="secrets"`, nil},
+		{`type=SYSCALL msg=audit(1697062455.124:101): arch=c000003e syscall=59 success=yes comm=2F746D702F6D7920736372697074 exe="/usr/bin/bash"`, nil},
+		{`type=CWD msg=audit(1697062455.123:100): cwd="/home/alice"`, nil},
+		{`type=PATH msg=audit(1697062455.123:100): item=0 name="/etc/shadow" inode=1234 nametype=NORMAL`, nil},
+		{`type=PROCTITLE msg=audit(1697062455.124:101): proctitle=62617368002D63006C73202D6C61`, nil},
+		{`type=EOE msg=audit(1697062455.124:101): `,
+			map[string]string{
+				"timestamp":                  "1697062455.124",
+				"_audit_serial":              "101",
+				"_audit_types":               "SYSCALL,PROCTITLE",
+				"_audit_syscall_comm":        "/tmp/my script",
+				"_audit_proctitle_proctitle": "bash -c ls -la",
+				"level":                      "6",
+			}},
+		{`type=PATH msg=audit(1697062455.123:100): item=1 name=2F746D702F612062 nametype=CREATE`, nil},
+		{`type=EOE msg=audit(1697062455.123:100): `,
+			map[string]string{
+				"_audit_serial":       "100",
+				"_audit_types":        "SYSCALL,CWD,PATH",
+				"_audit_syscall_a0":   "7ffd",
+				"_audit_syscall_arch": "c000003e",
+				"_audit_cwd_cwd":      "/home/alice",
+				"_audit_path_0_name":  "/etc/shadow",
+				"_audit_path_1_name":  "/tmp/a b",
+				"_audit_path_1_item":  "1",
+				"level":               "4",
+				"short_message":       "SYSCALL CWD PATH key=secrets exe=/usr/bin/cat comm=cat name=/etc/shadow success=no",
+			}},
+
+		// An EOE without records is skipped
+		{`type=EOE msg=audit(1697062455.125:102): `, nil},
+	})
+
+	if _, err := p.Parse(`Oct 11 22:14:15 web1 sshd[812]: Accepted publickey`); err == nil || errors.Is(err, ErrSkip) {
+		t.Errorf("Parse(not audit) = %v, want an error", err)
+	}
+}
+
+func TestAuditdUserMessages(t *testing.T) {
+	p := testParser(t, formatAuditd)
+
+	checkAuditd(t, p, []parseTest{
+		{`type=USER_LOGIN msg=audit(1697062456.000:200): pid=812 uid=0 auid=1000 ses=3 msg='op=login acct="alice" exe="/usr/sbin/sshd" hostname=? addr=203.0.113.9 terminal=sshd res=failed'`,
+			map[string]string{
+				"_audit_user_login_acct": "alice",
+				"_audit_user_login_addr": "203.0.113.9",
+				"_audit_user_login_res":  "failed",
+				"level":                  "4",
+				"short_message":          "USER_LOGIN op=login acct=alice exe=/usr/sbin/sshd res=failed",
+			}},
+		// Enriched logs add the interpreted fields after a group separator
+		{"type=USER_CMD msg=audit(1697062456.001:201): pid=9 uid=1000 auid=1000 ses=3 msg='cwd=\"/home/alice\" cmd=6C73202D6C61 exe=\"/usr/bin/sudo\" terminal=pts/0 res=success'\x1dUID=\"alice\" AUID=\"alice\"",
+			map[string]string{
+				"_audit_user_cmd_cmd":  "ls -la",
+				"_audit_user_cmd_res":  "success",
+				"_audit_user_cmd_UID":  "alice",
+				"_audit_user_cmd_AUID": "alice",
+				"level":                "6",
+			}},
+		// Values that do not decode to text, or are not hex encoded fields, are kept as they are
+		{`type=USER_AVC msg=audit(1697062456.002:202): pid=1 uid=0 msg='data=0102 old=1 new=0 key=abc res=success'`,
+			map[string]string{"_audit_user_avc_data": "0102", "_audit_user_avc_old": "1", "_audit_user_avc_new": "0", "_audit_user_avc_key": "abc"}},
+	})
+}
+
+func TestAuditdFlush(t *testing.T) {
+	p := testParser(t, formatAuditd)
+
+	checkAuditd(t, p, []parseTest{
+		{`type=CONFIG_CHANGE msg=audit(1697062457.000:300): op=set audit_enabled=1 old=1 auid=1000 ses=3 res=1`, nil},
+		{`type=SYSCALL msg=audit(1697062457.001:301): arch=c000003e syscall=59 success=yes`, nil},
+	})
+
+	if _, ok := p.Flush(time.Hour); ok {
+		t.Error("Flush returned an event before the timeout")
+	}
+
+	seen := map[string]bool{}
+	for {
+		g, ok := p.Flush(0)
+		if !ok {
+			break
+		}
+		seen[fieldString(g["_audit_serial"])] = true
+		if g["_audit_types"] == "CONFIG_CHANGE" && g["_audit_config_change_old"] != "1" {
+			t.Errorf("old = %v, want 1", g["_audit_config_change_old"])
+		}
+	}
+	if !seen["300"] || !seen["301"] {
+		t.Errorf("Flush returned %v, want both incomplete events", seen)
+	}
+}
@@ -0,0 +1,217 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"log2sqs/global"
+)
+
+// Matches the start of a CEF or LEEF event
+var securityEventRegex = regexp.MustCompile(`(CEF:\d+|LEEF:[12]\.0)\|`)
+
+// Matches the start of a CEF extension key=value pair. Keys can not contain escaped characters,
+// so an escaped \= in a value is not mistaken for a key.
+var cefKeyRegex = regexp.MustCompile(`(?:^|\s)([A-Za-z0-9_.\[\]-]+)=`)
+
+// Unescape CEF header fields and extension values
+var cefHeaderReplacer = strings.NewReplacer(`\|`, `|`, `\\`, `\`)
+var cefValueReplacer = strings.NewReplacer(`\=`, `=`, `\\`, `\`, `\n`, "\n", `\r`, "\r")
+
+// CEF severity names
+var cefSeverities = map[string]int{
+	"unknown":   0,
+	"low":       3,
+	"medium":    6,
+	"high":      8,
+	"very-high": 10,
+}
+
+// ParseSecurityEvent detects an ArcSight CEF or QRadar LEEF event in a syslog message with the
+// header removed and adds its header fields and extension attributes to the GELF message.
+// Returns false if the message is not CEF or LEEF.
+func ParseSecurityEvent(msg string, g GELFMessage) bool {
+	loc := securityEventRegex.FindStringSubmatchIndex(msg)
+	if loc == nil {
+		return false
+	}
+
+	// Some devices add a prefix before the event
+	msg = strings.TrimRight(msg[loc[0]:], "\r\n")
+
+	if strings.HasPrefix(msg, "CEF:") {
+		return parseCEF(msg, g)
+	}
+	return parseLEEF(msg, g)
+}
+
+// parseCEF parses CEF:Version|Vendor|Product|Version|Signature ID|Name|Severity|Extension
+func parseCEF(msg string, g GELFMessage) bool {
+	header := splitHeader(strings.TrimPrefix(msg, "CEF:"), 7)
+	if len(header) < 7 {
+		return false
+	}
+
+	g["_event_format"] = "CEF"
+	g["_cef_version"] = header[0]
+	g["_cef_device_vendor"] = header[1]
+	g["_cef_device_product"] = header[2]
+	g["_cef_device_version"] = header[3]
+	g["_cef_signature_id"] = header[4]
+	g["_cef_name"] = header[5]
+	g["_cef_severity"] = header[6]
+	g["short_message"] = emptyString(header[5])
+
+	if level, ok := cefLevel(header[6]); ok {
+		g["level"] = level
+	}
+
+	if len(header) > 7 {
+		addAttributes(g, cefExtension(header[7]))
+	}
+	return true
+}
+
+// parseLEEF parses LEEF:1.0|Vendor|Product|Version|EventID|attributes and
+// LEEF:2.0|Vendor|Product|Version|EventID|Delimiter|attributes
+func parseLEEF(msg string, g GELFMessage) bool {
+	v2 := strings.HasPrefix(msg, "LEEF:2.0|")
+
+	n := 5
+	if v2 {
+		n = 6
+	}
+	header := splitHeader(strings.TrimPrefix(msg, "LEEF:"), n)
+	if len(header) < 5 {
+		return false
+	}
+
+	// LEEF 1.0 attributes are tab separated. LEEF 2.0 specifies the delimiter, either as a
+	// character or in hex (x09 or 0x09).
+	delim := "\t"
+	attrs := ""
+	if v2 && len(header) > 6 {
+		if d := leefDelimiter(header[5]); d != "" {
+			delim = d
+		}
+		attrs = header[6]
+	} else if !v2 && len(header) > 5 {
+		attrs = header[5]
+	}
+
+	g["_event_format"] = "LEEF"
+	g["_leef_version"] = header[0]
+	g["_leef_vendor"] = header[1]
+	g["_leef_product"] = header[2]
+	g["_leef_product_version"] = header[3]
+	g["_leef_event_id"] = header[4]
+	g["short_message"] = emptyString(header[4])
+
+	obj := make(map[string]interface{})
+	for _, kv := range splitPairs(attrs, delim, "=") {
+		obj[kv[0]] = kv[1]
+	}
+
+	if sev, ok := obj["sev"]; ok {
+		if level, ok := cefLevel(sev.(string)); ok {
+			g["level"] = level
+		}
+	}
+	addAttributes(g, obj)
+	return true
+}
+
+// splitHeader splits up to n pipe-separated header fields, honouring escaped pipes. The
+// remainder of the message is returned as the last field.
+func splitHeader(s string, n int) []string {
+	var fields []string
+
+	start := 0
+	for i := 0; i < len(s) && len(fields) < n; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '|':
+			fields = append(fields, cefHeaderReplacer.Replace(s[start:i]))
+			start = i + 1
+		}
+	}
+
+	// The remainder is either the last header field or the extension
+	if len(fields) < n {
+		fields = append(fields, cefHeaderReplacer.Replace(s[start:]))
+	} else {
+		fields = append(fields, s[start:])
+	}
+	return fields
+}
+
+// cefExtension returns the key=value pairs in a CEF extension. Values may contain spaces,
+// so each value extends to the start of the next key.
+func cefExtension(s string) map[string]interface{} {
+	obj := make(map[string]interface{})
+
+	matches := cefKeyRegex.FindAllStringSubmatchIndex(s, -1)
+	for i, m := range matches {
+		end := len(s)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		obj[s[m[2]:m[3]]] = cefValueReplacer.Replace(strings.TrimSpace(s[m[1]:end]))
+	}
+	return obj
+}
+
+// addAttributes adds extension attributes as additional fields, storing numbers as numbers
+func addAttributes(g GELFMessage, obj map[string]interface{}) {
+	for k, v := range obj {
+		obj[k] = inferType(v.(string))
+	}
+	jsonFlatten(g, "", obj, "_")
+}
+
+// leefDelimiter returns the attribute delimiter specified in a LEEF 2.0 header
+func leefDelimiter(s string) string {
+	if len(s) == 1 {
+		return s
+	}
+
+	hex := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "0x"), "x")
+	if c, err := strconv.ParseUint(hex, 16, 8); err == nil && hex != "" {
+		return string(rune(c))
+	}
+	return ""
+}
+
+// cefLevel maps a CEF severity (0-10 or Low, Medium, High, Very-High) or a LEEF severity
+// (1-10) to a syslog level
+func cefLevel(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	sev, err := strconv.Atoi(s)
+	if err != nil {
+		var ok bool
+		sev, ok = cefSeverities[s]
+		if !ok {
+			return 0, false
+		}
+	}
+
+	switch {
+	case sev < 0:
+		return 0, false
+	case sev <= 3:
+		return global.INFO, true
+	case sev <= 6:
+		return global.WARN, true
+	case sev <= 8:
+		return global.ERR, true
+	default:
+		return global.CRIT, true
+	}
+}
@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"testing"
+)
+
+func TestParseSecurityEvent(t *testing.T) {
+	tests := []parseTest{
+		{`CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232`,
+			map[string]string{
+				"_event_format":       "CEF",
+				"_cef_version":        "0",
+				"_cef_device_vendor":  "Security",
+				"_cef_device_product": "threatmanager",
+				"_cef_device_version": "1.0",
+				"_cef_signature_id":   "100",
+				"short_message":       "worm successfully stopped",
+				"_cef_severity":       "10",
+				"level":               "2",
+				"_src":                "10.0.0.1",
+				"_dst":                "2.1.2.2",
+				"_spt":                "1232",
+			}},
+		// Escaped pipes in the header, and escaped equals signs, backslashes and newlines in values
+		{`CEF:0|ACME|Fire\|Wall|2.1|deny|Blocked \\ packet|Medium|msg=rule a\=b matched\nsee log cs1Label=path cs1=C:\\Windows\\Temp act=blocked`,
+			map[string]string{
+				"_cef_device_product": "Fire|Wall",
+				"short_message":       `Blocked \ packet`,
+				"level":               "4",
+				"_msg":                "rule a=b matched\nsee log",
+				"_cs1":                `C:\Windows\Temp`,
+				"_act":                "blocked",
+			}},
+		// A device prefix before the event and a header without an extension
+		{`Oct 11 22:14:15 fw1 CEF:0|Vendor|Product|1|42|Login failed|Low|`,
+			map[string]string{"_cef_signature_id": "42", "level": "6"}},
+		{`LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=10.50.1.1	dst=2.10.20.20	spt=1200	sev=7	usrName=John Doe`,
+			map[string]string{
+				"_event_format":         "LEEF",
+				"_leef_vendor":          "Microsoft",
+				"_leef_product":         "MSExchange",
+				"_leef_product_version": "4.0 SP1",
+				"short_message":         "15345",
+				"_src":                  "10.50.1.1",
+				"_sev":                  "7",
+				"level":                 "3",
+				"_usrName":              "John Doe",
+			}},
+		{`LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^sev=5^proto=tcp`,
+			map[string]string{"_leef_event_id": "41", "_dst": "10.0.0.5", "_proto": "tcp", "level": "4"}},
+		{`LEEF:2.0|Vendor|Product|1.0|7|x09|src=10.0.1.8	msg=tab delimited`,
+			map[string]string{"_src": "10.0.1.8", "_msg": "tab delimited"}},
+		// Truncated headers and other messages are not security events
+		{`CEF:0|Security|threatmanager|1.0|100`, nil},
+		{`LEEF:1.0|Microsoft|MSExchange`, nil},
+		{`CEF:zero|Vendor|Product`, nil},
+		{`user logged in`, nil},
+	}
+
+	for _, tt := range tests {
+		g := GELFMessage{}
+		ok := ParseSecurityEvent(tt.in, g)
+		if tt.fields == nil {
+			if ok {
+				t.Errorf("ParseSecurityEvent(%q) = %v, want false", tt.in, g)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("ParseSecurityEvent(%q) = false", tt.in)
+			continue
+		}
+		for k, want := range tt.fields {
+			if got := fieldString(g[k]); got != want {
+				t.Errorf("ParseSecurityEvent(%q)[%s] = %q, want %q", tt.in, k, got, want)
+			}
+		}
+	}
+}
+
+func TestLEEFDelimiter(t *testing.T) {
+	tests := map[string]string{"^": "^", "x09": "\t", "0x7c": "|", "": "", "xzz": ""}
+	for in, want := range tests {
+		if got := leefDelimiter(in); got != want {
+			t.Errorf("leefDelimiter(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
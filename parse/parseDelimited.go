@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"log2sqs/config"
+)
+
+// ErrSkip is returned for lines that do not contain an event, such as header lines
+var ErrSkip = errors.New("line skipped")
+
+// delimitedOptions describes a delimited (CSV, TSV or W3C extended) log. The columns are
+// updated from header lines, so each Parser instance tracks the header of its own file.
+type delimitedOptions struct {
+	delimiter rune     // column delimiter
+	quotes    bool     // values may be quoted
+	unset     string   // marker for a column without a value
+	headerRow bool     // the first line that is not a comment, or any line starting with the first column name, contains the column names
+	columns   []string // current column names
+}
+
+// newDelimitedOptions returns the options for a custom delimited parser
+func newDelimitedOptions(p config.CustomParser) (delimitedOptions, error) {
+	o := delimitedOptions{
+		delimiter: ',',
+		quotes:    !p.DisableQuotes,
+		unset:     p.Unset,
+		headerRow: p.HeaderRow,
+		columns:   p.Columns,
+	}
+
+	if p.Delimiter != "" {
+		d, err := parseDelimiter(p.Delimiter)
+		if err != nil {
+			return o, err
+		}
+		o.delimiter = d
+	}
+	return o, nil
+}
+
+// parseDelimiter converts a delimiter such as ",", "tab", "\t" or "\x09" to a character
+func parseDelimiter(s string) (rune, error) {
+	switch strings.ToLower(s) {
+	case "tab":
+		return '\t', nil
+	case "space":
+		return ' ', nil
+	}
+
+	if strings.HasPrefix(s, `\`) {
+		tmp, err := strconv.Unquote(`"` + s + `"`)
+		if err == nil {
+			s = tmp
+		}
+	}
+
+	r := []rune(s)
+	if len(r) != 1 || r[0] == '"' || r[0] == '\r' || r[0] == '\n' {
+		return 0, fmt.Errorf("invalid delimiter %q", s)
+	}
+	return r[0], nil
+}
+
+// delimitedParser parses a line of a delimited log using the current columns
+func (p *Parser) delimitedParser(s string) (GELFMessage, error) {
+	o := &p.delimitedOptions
+
+	if strings.TrimSpace(s) == "" {
+		return GELFMessage{}, ErrSkip
+	}
+
+	// Header and comment lines
+	if strings.HasPrefix(s, "#") {
+		p.delimitedHeader(s)
+		return GELFMessage{}, ErrSkip
+	}
+
+	values, err := o.split(s)
+	if err != nil {
+		return GELFMessage{}, err
+	}
+
+	// Learn the columns from the first row, or from a header row that repeats the first column
+	// name, such as a VPC flow log that starts with "version account-id ..."
+	if o.headerRow && (len(o.columns) == 0 || values[0] == o.columns[0]) {
+		o.columns = values
+		return GELFMessage{}, ErrSkip
+	}
+
+	if len(o.columns) == 0 {
+		return GELFMessage{}, errors.New("no columns defined")
+	}
+
+	obj := make(map[string]interface{})
+	for i, v := range values {
+		name := fmt.Sprintf("field%d", i+1)
+		if i < len(o.columns) {
+			name = o.columns[i]
+		} else if v == "" {
+			continue
+		}
+
+		if v == o.unset && o.unset != "" {
+			continue
+		}
+		if _, ok := p.keyOptions.fields[name]; ok {
+			obj[name] = v
+		} else {
+			obj[name] = inferType(v)
+		}
+	}
+
+	// W3C extended logs have separate date and time columns in UTC
+	if date, ok := obj["date"].(string); ok {
+		if t, ok := obj["time"].(string); ok {
+			if _, exists := obj["timestamp"]; !exists {
+				obj["timestamp"] = date + "T" + t + "Z"
+				delete(obj, "date")
+				delete(obj, "time")
+			}
+		}
+	}
+
+	return p.keyMapper(obj, s)
+}
+
+// delimitedHeader updates the options from a W3C (#Fields:) or Zeek (#fields, #separator,
+// #unset_field) header line
+func (p *Parser) delimitedHeader(s string) {
+	o := &p.delimitedOptions
+
+	name, value, _ := strings.Cut(strings.TrimPrefix(s, "#"), string(o.delimiter))
+	if o.delimiter != ' ' {
+		if n, v, ok := strings.Cut(name, " "); ok {
+			name = n
+			value = v + string(o.delimiter) + value
+		}
+	}
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(strings.TrimSuffix(name, ":")) {
+	case "fields":
+		if o.delimiter == ' ' || o.delimiter == '\t' {
+			o.columns = strings.Fields(value)
+		} else {
+			o.columns = strings.Split(value, string(o.delimiter))
+		}
+	case "separator":
+		if d, err := parseDelimiter(value); err == nil {
+			o.delimiter = d
+		}
+	case "unset_field":
+		o.unset = value
+	}
+}
+
+// split returns the values in a line
+func (o *delimitedOptions) split(s string) ([]string, error) {
+	if !o.quotes {
+		return strings.Split(s, string(o.delimiter)), nil
+	}
+
+	r := csv.NewReader(strings.NewReader(s))
+	r.Comma = o.delimiter
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	return r.Read()
+}
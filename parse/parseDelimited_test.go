@@ -0,0 +1,130 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"testing"
+
+	"log2sqs/config"
+)
+
+func TestW3CParser(t *testing.T) {
+	p := testParser(t, formatW3C)
+
+	checkParser(t, p, []parseTest{
+		{`10.0.0.10 GET /default.htm`, nil},
+
+		// Header lines are skipped
+		{`#Software: Microsoft Internet Information Services 10.0`, nil},
+		{`#Version: 1.0`, nil},
+		{`#Date: 2023-10-11 22:14:15`, nil},
+		{`#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) sc-status time-taken`, nil},
+
+		{`2023-10-11 22:14:15 10.0.0.10 GET /default.htm - 80 - 203.0.113.5 Mozilla/5.0+(Windows+NT+10.0;+Win64;+x64) 200 15`,
+			map[string]string{
+				"timestamp":       "1697062455",
+				"_s-ip":           "10.0.0.10",
+				"_cs-method":      "GET",
+				"_cs-uri-stem":    "/default.htm",
+				"_cs-uri-query":   "<none>",
+				"_c-ip":           "203.0.113.5",
+				"_cs_User-Agent_": "Mozilla/5.0+(Windows+NT+10.0;+Win64;+x64)",
+				"_sc-status":      "200",
+				"_time-taken":     "15",
+				"_date":           "<none>",
+			}},
+
+		// A new header part way through the file changes the columns
+		{`#Fields: date time c-ip sc-status`, nil},
+		{`2023-10-11 22:14:16 198.51.100.7 404`, map[string]string{"_c-ip": "198.51.100.7", "_sc-status": "404", "_s-ip": "<none>"}},
+		{``, nil},
+	})
+}
+
+func TestZeekParser(t *testing.T) {
+	p := testParser(t, formatZeek)
+
+	checkParser(t, p, []parseTest{
+		{"#separator \\x09", nil},
+		{"#set_separator\t,", nil},
+		{"#empty_field\t(empty)", nil},
+		{"#unset_field\t-", nil},
+		{"#path\tconn", nil},
+		{"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tservice\tduration", nil},
+		{"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tstring\tinterval", nil},
+
+		{"1697062455.123456\tCHhAvVGS1DHFjwGM9\t10.0.0.5\t51234\t93.184.216.34\t443\ttcp\tssl\t0.250000",
+			map[string]string{
+				"timestamp":  "1697062455.123456",
+				"_uid":       "CHhAvVGS1DHFjwGM9",
+				"_id.orig_h": "10.0.0.5",
+				"_id.orig_p": "51234",
+				"_id.resp_p": "443",
+				"_service":   "ssl",
+				"_duration":  "0.25",
+			}},
+		{"1697062456.000001\tC4J4Th3PJpwUYZZ6gc\t10.0.0.5\t53\t10.0.0.1\t53\tudp\t-\t-",
+			map[string]string{"timestamp": "1697062456.000001", "_service": "<none>", "_duration": "<none>"}},
+
+		// A truncated line keeps the columns it has
+		{"1697062457.5\tCmES5u32sYpV7JYN\t10.0.0.5",
+			map[string]string{"_uid": "CmES5u32sYpV7JYN", "_id.orig_h": "10.0.0.5", "_proto": "<none>"}},
+		{"#close\t2023-10-11-23-00-00", nil},
+	})
+}
+
+func TestCSVParser(t *testing.T) {
+	p := addTestParser(t, config.CustomParser{
+		Name:      "test_csv",
+		Type:      "delimited",
+		HeaderRow: true,
+		Unset:     "N/A",
+		Fields:    map[string]config.RegexField{"zip": {}},
+	})
+
+	checkParser(t, p, []parseTest{
+		{`time,level,user,zip,message`, nil},
+		{`2023-10-11T22:14:15Z,error,"Doe, Jane",02134,"disk ""/var"" is full"`,
+			map[string]string{
+				"timestamp":     "1697062455",
+				"level":         "3",
+				"_user":         "Doe, Jane",
+				"_zip":          "02134",
+				"short_message": `disk "/var" is full`,
+			}},
+		{`2023-10-11T22:14:16Z,info,N/A,N/A,ok,extra`,
+			map[string]string{"_user": "<none>", "_zip": "<none>", "_field6": "extra"}},
+		{`2023-10-11T22:14:17Z,"info`, map[string]string{"level": "6"}},
+	})
+
+	p = addTestParser(t, config.CustomParser{Name: "test_tsv", Type: "delimited", Delimiter: "tab", Columns: []string{"a", "b"}, DisableQuotes: true})
+	checkParser(t, p, []parseTest{
+		{"\"x\tb", map[string]string{"_a": `"x`, "_b": "b"}},
+	})
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want rune
+		ok   bool
+	}{
+		{",", ',', true},
+		{"tab", '\t', true},
+		{`\t`, '\t', true},
+		{`\x09`, '\t', true},
+		{"space", ' ', true},
+		{"|", '|', true},
+		{"::", 0, false},
+		{`"`, 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseDelimiter(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseDelimiter(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
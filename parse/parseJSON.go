@@ -0,0 +1,298 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+)
+
+// keyOptions describes how application JSON and key=value logs are mapped to GELF
+type keyOptions struct {
+	messageKeys   []string                     // keys that may contain the message
+	levelKeys     []string                     // keys that may contain the level
+	timestampKeys []string                     // keys that may contain the timestamp
+	separator     string                       // separator used when flattening nested objects
+	pairSeparator string                       // separator between key=value pairs, whitespace if empty
+	delimiter     string                       // delimiter between the key and value
+	fields        map[string]config.RegexField // explicit types for key=value pairs
+}
+
+// Defaults cover the common logging libraries (zap, logrus, bunyan, pino, etc.)
+var defaultKeyOptions = keyOptions{
+	messageKeys:   []string{"msg", "message", "short_message"},
+	levelKeys:     []string{"level", "severity", "lvl"},
+	timestampKeys: []string{"time", "timestamp", "ts", "@timestamp"},
+	separator:     "_",
+	delimiter:     "=",
+}
+
+// Level names used by logging libraries, mapped to syslog levels
+var jsonLevels = map[string]int{
+	"emerg":       global.EMERG,
+	"emergency":   global.EMERG,
+	"panic":       global.EMERG,
+	"alert":       global.ALERT,
+	"crit":        global.CRIT,
+	"critical":    global.CRIT,
+	"fatal":       global.CRIT,
+	"dpanic":      global.CRIT,
+	"err":         global.ERR,
+	"error":       global.ERR,
+	"warn":        global.WARN,
+	"warning":     global.WARN,
+	"notice":      global.NOTICE,
+	"info":        global.INFO,
+	"information": global.INFO,
+	"debug":       global.DEBUG,
+	"trace":       global.DEBUG,
+}
+
+// newKeyOptions returns the options for a custom JSON or key=value parser, using the defaults
+// for any that are not specified
+func newKeyOptions(p config.CustomParser) keyOptions {
+	o := defaultKeyOptions
+	if len(p.MessageKeys) > 0 {
+		o.messageKeys = p.MessageKeys
+	}
+	if len(p.LevelKeys) > 0 {
+		o.levelKeys = p.LevelKeys
+	}
+	if len(p.TimestampKeys) > 0 {
+		o.timestampKeys = p.TimestampKeys
+	}
+	if p.Separator != "" {
+		o.separator = p.Separator
+	}
+	if p.PairSeparator != "" {
+		o.pairSeparator = p.PairSeparator
+	}
+	if p.KeyValueDelimiter != "" {
+		o.delimiter = p.KeyValueDelimiter
+	}
+	o.fields = namedFields(p.Fields)
+	return o
+}
+
+// jsonParser parses an application JSON log into a GELF message
+func (p *Parser) jsonParser(s string) (GELFMessage, error) {
+	var obj map[string]interface{}
+
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	err := d.Decode(&obj)
+	if err != nil {
+		return GELFMessage{}, err
+	}
+	if obj == nil {
+		return GELFMessage{}, errors.New("JSON log is not an object")
+	}
+
+	return p.keyMapper(obj, s)
+}
+
+// keyMapper maps the well-known keys in obj to the GELF message, timestamp and level and adds
+// the remaining keys as additional fields
+func (p *Parser) keyMapper(obj map[string]interface{}, s string) (GELFMessage, error) {
+
+	// Start the GELF message
+	g := GELFMessage{}
+	g["version"] = "1.1"
+	g["host"] = config.Config.Hostname
+	g["_original_format"] = p.format
+
+	o := p.keyOptions
+
+	// Keys with explicit types
+	for key, f := range o.fields {
+		if v, ok := obj[key]; ok && v != nil {
+			delete(obj, key)
+			err := addField(g, f, jsonString(v), p.location)
+			if err != nil {
+				return GELFMessage{}, err
+			}
+		}
+	}
+
+	if _, v, ok := jsonTake(obj, o.messageKeys); ok {
+		g["short_message"] = emptyString(jsonString(v))
+	} else if _, ok := g["short_message"]; !ok {
+		g["short_message"] = emptyString(s)
+	}
+
+	if key, v, ok := jsonTake(obj, o.levelKeys); ok {
+		if level, ok := jsonLevel(v); ok {
+			g["level"] = level
+			if _, isNumber := v.(json.Number); !isNumber {
+				g["_level_name"] = jsonString(v)
+			}
+		} else {
+			obj[key] = v
+		}
+	}
+
+	if _, ok := g["timestamp"]; !ok {
+		g["timestamp"] = global.TimeStamp()
+	}
+	if key, v, ok := jsonTake(obj, o.timestampKeys); ok {
+		if ts, ok := jsonTimestamp(v); ok {
+			g["timestamp"] = ts
+		} else {
+			obj[key] = v
+		}
+	}
+
+	// Anything not used above becomes an additional field
+	jsonFlatten(g, "", obj, o.separator)
+	return g, nil
+}
+
+// jsonTake removes and returns the first of the keys present in the object
+func jsonTake(obj map[string]interface{}, keys []string) (string, interface{}, bool) {
+	for _, k := range keys {
+		if v, ok := obj[k]; ok && v != nil {
+			delete(obj, k)
+			return k, v, true
+		}
+	}
+	return "", nil, false
+}
+
+// jsonFlatten adds the values in obj to the GELF message as additional fields, joining the
+// keys of nested objects with the separator
+func jsonFlatten(g GELFMessage, prefix string, obj map[string]interface{}, sep string) {
+	for k, v := range obj {
+		name := k
+		if prefix != "" {
+			name = prefix + sep + k
+		}
+
+		switch val := v.(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			jsonFlatten(g, name, val, sep)
+			continue
+		case json.Number:
+			if i, err := val.Int64(); err == nil {
+				g[jsonFieldName(name)] = i
+			} else if f, err := val.Float64(); err == nil {
+				g[jsonFieldName(name)] = f
+			} else {
+				g[jsonFieldName(name)] = val.String()
+			}
+		default:
+			g[jsonFieldName(name)] = jsonString(val)
+		}
+	}
+}
+
+// jsonFieldName returns the GELF additional field name for a key
+func jsonFieldName(key string) string {
+	name := fieldNameRegex.ReplaceAllString(key, "_")
+	if !strings.HasPrefix(name, "_") {
+		name = "_" + name
+	}
+
+	// _id is reserved by Graylog
+	if name == "_id" {
+		name = "__id"
+	}
+	return name
+}
+
+// jsonString returns a JSON value as a string. Arrays are returned as JSON.
+func jsonString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// jsonLevel converts a level name or number to a syslog level. Numbers greater than 7 are
+// treated as bunyan/pino levels (10 trace to 60 fatal).
+func jsonLevel(v interface{}) (int, bool) {
+	switch val := v.(type) {
+	case string:
+		if l, ok := jsonLevels[strings.ToLower(strings.TrimSpace(val))]; ok {
+			return l, true
+		}
+		if n, err := strconv.Atoi(val); err == nil {
+			return jsonLevel(json.Number(strconv.Itoa(n)))
+		}
+	case json.Number:
+		n, err := val.Int64()
+		if err != nil {
+			return 0, false
+		}
+		switch {
+		case n < 0:
+			return 0, false
+		case n <= global.DEBUG:
+			return int(n), true
+		case n < 30:
+			return global.DEBUG, true
+		case n < 40:
+			return global.INFO, true
+		case n < 50:
+			return global.WARN, true
+		case n < 60:
+			return global.ERR, true
+		default:
+			return global.CRIT, true
+		}
+	}
+	return 0, false
+}
+
+// jsonTimestamp converts an RFC3339 string or an epoch time in seconds, milliseconds,
+// microseconds or nanoseconds to a GELF timestamp
+func jsonTimestamp(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err == nil {
+			return global.UnixTime(t), true
+		}
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return jsonTimestamp(json.Number(val))
+		}
+	case json.Number:
+		f, err := val.Float64()
+		if err != nil || f <= 0 {
+			return 0, false
+		}
+
+		// Use the magnitude to determine the unit, and keep microseconds as for other inputs
+		switch {
+		case f >= 1e17:
+			f = f / 1e3
+		case f >= 1e14:
+		case f >= 1e11:
+			f = f * 1e3
+		default:
+			f = f * 1e6
+		}
+		return global.UnixTime(time.UnixMicro(int64(math.Round(f)))), true
+	}
+	return 0, false
+}
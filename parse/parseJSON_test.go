@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"encoding/json"
+	"testing"
+
+	"log2sqs/config"
+)
+
+func TestJSONParser(t *testing.T) {
+	p := testParser(t, formatJSON)
+
+	checkParser(t, p, []parseTest{
+		// zap
+		{`{"level":"warn","ts":1697062455.5,"caller":"server/main.go:42","msg":"slow request","duration":1.25,"attempt":3}`,
+			map[string]string{
+				"short_message": "slow request",
+				"level":         "4",
+				"_level_name":   "warn",
+				"timestamp":     "1697062455.5",
+				"_caller":       "server/main.go:42",
+				"_duration":     "1.25",
+				"_attempt":      "3",
+			}},
+		// logrus
+		{`{"level":"error","msg":"connection refused","time":"2023-10-11T22:14:15+02:00","id":7,"ok":false}`,
+			map[string]string{"level": "3", "timestamp": "1697055255", "__id": "7", "_ok": "false"}},
+		// bunyan and pino use numeric levels
+		{`{"name":"api","hostname":"web1","pid":812,"level":50,"msg":"request failed","time":"2023-10-11T22:14:15.000Z","v":0}`,
+			map[string]string{"level": "3", "_level_name": "<none>", "_hostname": "web1", "_pid": "812"}},
+		{`{"level":30,"time":1697062455123,"msg":"listening"}`,
+			map[string]string{"level": "6", "timestamp": "1697062455.123"}},
+		// Nested objects are flattened, arrays are kept as JSON and nulls are dropped
+		{`{"message":"login","user":{"name":"alice","roles":["admin","dev"],"geo":{"country":"CA"}},"trace":null}`,
+			map[string]string{
+				"short_message":     "login",
+				"_user_name":        "alice",
+				"_user_roles":       `["admin","dev"]`,
+				"_user_geo_country": "CA",
+				"_trace":            "<none>",
+			}},
+		// Unknown levels and timestamps are kept as fields
+		{`{"msg":"x","level":"verbose","time":"yesterday","@version":"1"}`,
+			map[string]string{"_level": "verbose", "_time": "yesterday", "_version": "1", "level": "<none>"}},
+		// Without a message key the line is the message
+		{`{"event":"started"}`, map[string]string{"short_message": `{"event":"started"}`, "_event": "started"}},
+		{`{"msg":"truncated","level":"info","ts":16970`, nil},
+		{`["not","an","object"]`, nil},
+		{`null`, nil},
+		{`plain text`, nil},
+	})
+}
+
+func TestJSONCustomKeys(t *testing.T) {
+	p := addTestParser(t, config.CustomParser{
+		Name:          "test_json",
+		Type:          "json",
+		MessageKeys:   []string{"event.original"},
+		LevelKeys:     []string{"log.level"},
+		TimestampKeys: []string{"@t"},
+		Separator:     ".",
+		Fields: map[string]config.RegexField{
+			"client": {Field: "_client_ip", FType: "ip"},
+			"bytes":  {FType: "int"},
+		},
+	})
+
+	checkParser(t, p, []parseTest{
+		{`{"@t":"2023-10-11T22:14:15.5Z","log.level":"INFO","event.original":"GET /","client":"::1","bytes":"512","http":{"request":{"method":"GET"}}}`,
+			map[string]string{
+				"timestamp":            "1697062455.5",
+				"level":                "6",
+				"short_message":        "GET /",
+				"_client_ip":           "::1",
+				"_client_ip_family":    "ipv6",
+				"_bytes":               "512",
+				"_http.request.method": "GET",
+				"_msg":                 "<none>",
+			}},
+		{`{"msg":"not the message key","log.level":"debug"}`,
+			map[string]string{"_msg": "not the message key", "level": "7"}},
+	})
+}
+
+func TestJSONTimestamp(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string // printed timestamp, or empty if not a timestamp
+	}{
+		{json.Number("1697062455"), "1697062455"},
+		{json.Number("1697062455.123456"), "1697062455.123456"},
+		{json.Number("1697062455123"), "1697062455.123"},
+		{json.Number("1697062455123456"), "1697062455.123456"},
+		{json.Number("1697062455123456789"), "1697062455.123457"},
+		{"1697062455.000001", "1697062455.000001"},
+		{"2023-10-11T22:14:15.123456789Z", "1697062455.123456"},
+		{"2023-10-11T22:14:15.000001-04:00", "1697076855.000001"},
+		{json.Number("0"), ""},
+		{json.Number("-5"), ""},
+		{"2023-10-11 22:14:15", ""},
+		{true, ""},
+	}
+	for _, tt := range tests {
+		ts, ok := jsonTimestamp(tt.in)
+		got := ""
+		if ok {
+			got = fieldString(ts)
+		}
+		if got != tt.want {
+			t.Errorf("jsonTimestamp(%v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// logfmtParser parses logfmt and other key=value lines, such as
+// level=info msg="request done" dur=12ms status=200, into a GELF message
+func (p *Parser) logfmtParser(s string) (GELFMessage, error) {
+	s = strings.TrimRight(s, "\r\n")
+
+	// Bare words are allowed as flags, but free text is not logfmt
+	pairs, bare := splitPairsCount(s, p.keyOptions.pairSeparator, p.keyOptions.delimiter)
+	if len(pairs) == bare {
+		return GELFMessage{}, errors.New("no key value pairs found")
+	}
+	if bare > len(pairs)-bare {
+		return GELFMessage{}, errors.New("more words than key value pairs")
+	}
+
+	obj := make(map[string]interface{})
+	for _, kv := range pairs {
+		obj[kv[0]] = inferType(kv[1])
+	}
+	return p.keyMapper(obj, s)
+}
+
+// splitPairs returns the key and value of each pair in s. Pairs are separated by whitespace
+// if sep is empty. Quoted values may contain separators and backslash escapes. A key without a
+// value, such as "debug" in "debug user=bob", is given the value true.
+func splitPairs(s string, sep string, delim string) [][2]string {
+	pairs, _ := splitPairsCount(s, sep, delim)
+	return pairs
+}
+
+// splitPairsCount is splitPairs, and also returns the number of keys without a value
+func splitPairsCount(s string, sep string, delim string) ([][2]string, int) {
+	var pairs [][2]string
+	bare := 0
+
+	i := 0
+	for i < len(s) {
+		i = skipSeparator(s, i, sep)
+		if i >= len(s) {
+			break
+		}
+
+		// Read the key
+		start := i
+		for i < len(s) && !strings.HasPrefix(s[i:], delim) && !isSeparator(s, i, sep) {
+			i++
+		}
+		key := strings.TrimSpace(s[start:i])
+
+		if i >= len(s) || !strings.HasPrefix(s[i:], delim) {
+			if key != "" {
+				pairs = append(pairs, [2]string{key, "true"})
+				bare++
+			}
+			continue
+		}
+		i += len(delim)
+
+		// Read the value
+		var value string
+		if sep != "" {
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+		}
+		if i < len(s) && s[i] == '"' {
+			value, i = readQuoted(s, i)
+		} else {
+			start = i
+			for i < len(s) && !isSeparator(s, i, sep) {
+				i++
+			}
+			value = s[start:i]
+			if sep != "" {
+				value = strings.TrimSpace(value)
+			}
+		}
+
+		if key != "" {
+			pairs = append(pairs, [2]string{key, value})
+		}
+	}
+	return pairs, bare
+}
+
+// isSeparator returns true if a pair separator starts at position i
+func isSeparator(s string, i int, sep string) bool {
+	if sep == "" {
+		return unicode.IsSpace(rune(s[i]))
+	}
+	return strings.HasPrefix(s[i:], sep)
+}
+
+// skipSeparator returns the position of the first character after any separators at i
+func skipSeparator(s string, i int, sep string) int {
+	for i < len(s) {
+		switch {
+		case unicode.IsSpace(rune(s[i])):
+			i++
+		case sep != "" && strings.HasPrefix(s[i:], sep):
+			i += len(sep)
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// readQuoted reads a double-quoted value starting at position i and returns the unescaped value
+// and the position after the closing quote. An unterminated value extends to the end of the line.
+func readQuoted(s string, i int) (string, int) {
+	var b strings.Builder
+
+	for i++; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), i + 1
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), i
+}
+
+// inferType returns numbers as json.Number so they are added as numeric fields. Values with
+// leading zeros, such as identifiers, are left as strings.
+func inferType(v string) interface{} {
+	if strings.ContainsAny(v, "xXnN_") || len(v) > 1 && v[0] == '0' && v[1] != '.' {
+		return v
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return json.Number(v)
+	}
+	return v
+}
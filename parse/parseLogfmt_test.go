@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"fmt"
+	"testing"
+
+	"log2sqs/config"
+)
+
+func TestLogfmtParser(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+
+	p, err := New(formatLogfmt)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	tests := []struct {
+		in     string
+		fields map[string]string // expected fields, or nil if the line is not logfmt
+	}{
+		{`level=info msg="request done" dur=12ms status=200`, map[string]string{"short_message": "request done", "_dur": "12ms", "_status": "200"}},
+		{`msg="say \"hi\"\tnow" id=007`, map[string]string{"short_message": "say \"hi\"\tnow", "__id": "007"}},
+		{`debug user=bob`, map[string]string{"_debug": "true", "_user": "bob"}},
+		{`msg="unterminated value`, map[string]string{"short_message": "unterminated value"}},
+		{`key=`, map[string]string{"_key": ""}},
+		{`just some text`, nil},
+		{`user logged in from host=web1`, nil},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		g, err := p.Parse(tt.in)
+		if tt.fields == nil {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want error", tt.in, g)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %s", tt.in, err)
+			continue
+		}
+		for k, want := range tt.fields {
+			if fmt.Sprint(g[k]) != want {
+				t.Errorf("Parse(%q)[%s] = %#v, want %#v", tt.in, k, g[k], want)
+			}
+		}
+	}
+}
+
+func TestKVParser(t *testing.T) {
+	p := addTestParser(t, config.CustomParser{
+		Name:              "test_kv",
+		Type:              "kv",
+		PairSeparator:     ";",
+		KeyValueDelimiter: ":",
+		Fields:            map[string]config.RegexField{"src": {Field: "_src_ip", FType: "ip"}},
+	})
+
+	checkParser(t, p, []parseTest{
+		{`date: 2023-10-11T22:14:15Z; level: warn; src: 10.0.0.9; msg: "blocked; rule 7"; count: 0042; ratio: 0.5`,
+			map[string]string{
+				"_date":         "2023-10-11T22:14:15Z",
+				"level":         "4",
+				"_src_ip":       "10.0.0.9",
+				"short_message": "blocked; rule 7",
+				"_count":        "0042",
+				"_ratio":        "0.5",
+			}},
+		{`action: allow;; proto: tcp;`, map[string]string{"_action": "allow", "_proto": "tcp"}},
+		{`src: not-an-ip; msg: x`, map[string]string{"_src_ip": "<none>", "short_message": "x"}},
+		{`no pairs here`, nil},
+	})
+}
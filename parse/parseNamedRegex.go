@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"log2sqs/config"
+)
+
+// Matches characters that are not allowed in field names
+var fieldNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// namedRegexParser parses a line into a GELF message using a regex with named groups. Optional
+// groups that did not participate in the match are omitted.
+func (p *Parser) namedRegexParser(s string) (GELFMessage, error) {
+
+	// Check for nil parser - this should never happen
+	if p.regex == nil {
+		return GELFMessage{}, errors.New("regex parser is nil")
+	}
+
+	loc := p.regex.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return GELFMessage{}, errors.New("line does not match pattern")
+	}
+
+	// Start the GELF message
+	g := GELFMessage{}
+	g["version"] = "1.1"
+	g["host"] = config.Config.Hostname
+	g["_original_format"] = p.format
+
+	for i, name := range p.regex.SubexpNames() {
+		if name == "" || loc[2*i] < 0 {
+			continue
+		}
+
+		// Groups without a field definition are added as strings
+		field, ok := p.namedFields[name]
+		if !ok {
+			field = config.RegexField{Field: captureFieldName(name), FType: "string"}
+		}
+
+		err := addField(g, field, s[loc[2*i]:loc[2*i+1]], p.location)
+		if err != nil {
+			return GELFMessage{}, err
+		}
+	}
+
+	// short_message is required
+	if _, ok := g["short_message"]; !ok {
+		g["short_message"] = emptyString(s)
+	}
+	return g, nil
+}
+
+// captureFieldName converts a capture name into a GELF field name. GELF fields are kept, message
+// becomes the short_message, and all other fields are additional fields prefixed with "_".
+func captureFieldName(name string) string {
+	switch name {
+	case "timestamp", "short_message", "full_message", "level":
+		return name
+	case "message":
+		return "short_message"
+	}
+
+	// Flatten Logstash-style nested names such as [http][verb]
+	name = strings.Trim(fieldNameRegex.ReplaceAllString(strings.ReplaceAll(name, "][", "_"), "_"), "_")
+	return "_" + name
+}
@@ -0,0 +1,79 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"testing"
+
+	"log2sqs/config"
+)
+
+func TestNamedRegexParser(t *testing.T) {
+	p := addTestParser(t, config.CustomParser{
+		Name:  "test_namedregex",
+		Type:  "namedregex",
+		Regex: `^(?P<timestamp>\S+) \[(?P<level>\w+)\] (?P<user_id>\d+)?(?:@(?P<client_ip>\S+))? (?P<latency>\S+) (?P<message>.*)$`,
+		Fields: map[string]config.RegexField{
+			"timestamp": {FType: "rfc3339"},
+			"user_id":   {FType: "int"},
+			"client_ip": {FType: "ip"},
+			"latency":   {Field: "_latency_ms", FType: "float", OnError: "raw"},
+		},
+	})
+
+	checkParser(t, p, []parseTest{
+		{`2023-10-11T22:14:15.123456+02:00 [INFO] 1001@192.168.1.20 12.5 user signed in`,
+			map[string]string{
+				"timestamp":         "1697055255.123456",
+				"level":             "INFO",
+				"_user_id":          "1001",
+				"_client_ip":        "192.168.1.20",
+				"_client_ip_family": "ipv4",
+				"_latency_ms":       "12.5",
+				"short_message":     "user signed in",
+			}},
+		// Optional groups that did not participate are omitted, and OnError keeps the raw value
+		{`2023-10-11T22:14:15Z [WARN]  n/a slow request`,
+			map[string]string{"_user_id": "<none>", "_client_ip": "<none>", "_latency_ms": "n/a", "short_message": "slow request"}},
+		{`2023-10-11T22:14:15Z [WARN] abc@10.0.0.1 1 text`, nil},
+		{`2023-10-11T22:14:15Z [WARN]`, nil},
+		{`yesterday [INFO] 1 1 text`, nil},
+	})
+}
+
+func TestNamedRegexDefinitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		regex  string
+		fields map[string]config.RegexField
+	}{
+		{"test_bad_regex", `(?P<message>[`, nil},
+		{"test_no_group", `(?P<message>.*)`, map[string]config.RegexField{"mesage": {}}},
+		{"test_bad_type", `(?P<message>.*)`, map[string]config.RegexField{"message": {FType: "number"}}},
+		{"", `(?P<message>.*)`, nil},
+	}
+	for _, tt := range tests {
+		config.Config = config.Data{}
+		config.Config.CustomParsers = []config.CustomParser{{Name: tt.name, Type: "namedregex", Regex: tt.regex, Fields: tt.fields}}
+		if err := AddCustomParsers(); err == nil {
+			t.Errorf("AddCustomParsers(%s %q) succeeded", tt.name, tt.regex)
+		}
+	}
+
+	// Capture names become GELF field names
+	names := map[string]string{
+		"message":        "short_message",
+		"timestamp":      "timestamp",
+		"level":          "level",
+		"src_ip":         "_src_ip",
+		"[http][verb]":   "_http_verb",
+		"[source][port]": "_source_port",
+	}
+	for in, want := range names {
+		if got := captureFieldName(in); got != want {
+			t.Errorf("captureFieldName(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package parse
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -37,36 +38,92 @@ func (p *Parser) regexParser(s string) (GELFMessage, error) {
 
 	// Iterate over the fields and add them to the GELF message
 	for i := 1; i < len(result); i++ {
-		switch p.regexFields[i].FType {
+		err := addField(g, p.regexFields[i], result[i], p.location)
+		if err != nil {
+			return GELFMessage{}, err
+		}
+	}
+	return g, nil
+}
 
-		case "int":
-			g[p.regexFields[i].Field] = string2Int(result[i])
+// addField converts the value to the field's type and adds it to the GELF message. If the
+// value can not be converted, the field's OnError policy decides what happens. Dates without
+// a time zone are in the location.
+func addField(g GELFMessage, field config.RegexField, value string, loc *time.Location) error {
+	var v interface{}
+	var err error
 
-		case "date":
-			tmp := result[i]
-			if p.regexFields[i].AddTZ {
-				tmp = tmp + " +0000"
-			}
-			t, err := time.Parse(p.regexFields[i].DateFormat, tmp)
-			if err != nil {
-				return GELFMessage{}, errors.New(fmt.Sprintf("unable to parse date %s using format %s: %s", result[i], p.regexFields[i].DateFormat, err.Error()))
-			}
-			g[p.regexFields[i].Field] = t.Unix()
+	switch field.FType {
 
-		case "string":
-			g[p.regexFields[i].Field] = emptyString(result[i])
+	case "int":
+		v, err = strconv.Atoi(strings.TrimSpace(value))
 
-		default:
-			g[p.regexFields[i].Field] = emptyString(result[i])
+	case "float":
+		v, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+
+	case "bool":
+		v, err = parseBool(value)
+
+	case "ip":
+		var ip net.IP
+		ip, err = parseIP(value)
+		if err == nil {
+			v = ip.String()
+			g[field.Field+"_family"] = ipFamily(ip)
 		}
 
-		// Should this also be the short message Field (required)?
-		if p.regexFields[i].ShortMessage {
-			g["short_message"] = g[p.regexFields[i].Field]
+	case "duration":
+		v, err = parseDuration(value)
+
+	case "list", "intlist", "floatlist":
+		addList(g, field.Field, field.FType, value)
+		v = g[field.Field]
+
+	case "date":
+		v, err = parseDate(value, field.DateFormat, field.AddTZ, loc)
+
+	case "rfc3339":
+		v, err = parseDate(value, time.RFC3339Nano, false, loc)
+
+	case "epoch_s", "epoch_ms", "epoch_us":
+		v, err = parseEpoch(value, field.FType)
+
+	case "string":
+		v = emptyString(value)
+
+	default:
+		v = emptyString(value)
+	}
+
+	if err != nil {
+		switch fieldOnError(field) {
+		case "raw":
+			v = emptyString(value)
+		case "drop":
+			if field.ShortMessage {
+				g["short_message"] = emptyString(value)
+			}
+			return nil
+		default:
+			if field.FType == "date" || field.FType == "rfc3339" {
+				return err
+			}
+			return errors.New(fmt.Sprintf("unable to convert %s to %s for field %s", value, field.FType, field.Field))
 		}
+	}
+	g[field.Field] = v
 
+	// Should this also be the short message Field (required)?
+	if field.ShortMessage {
+		g["short_message"] = g[field.Field]
 	}
-	return g, nil
+	return nil
+}
+
+// ConvertField converts a value to the field's type and adds it to the GELF message, in the same
+// way as the parsers
+func ConvertField(g GELFMessage, field config.RegexField, value string) error {
+	return addField(g, field, value, nil)
 }
 
 // string2Int returns the integer contained in string or 0
@@ -78,6 +135,47 @@ func string2Int(s string) int {
 	return ret
 }
 
+// string2Float returns the floating point number contained in string or 0
+func string2Float(s string) float64 {
+	ret, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		ret = 0
+	}
+	return ret
+}
+
+// addList adds a list of values separated by commas or colons, such as the nginx
+// $upstream_response_time "0.004, 0.002 : 0.010", as a normalized comma-separated string.
+// In string lists, only a colon between spaces separates values, so that host:port pairs
+// such as the nginx $upstream_addr "10.0.0.1:80 : 10.0.0.2:80" are kept. For numeric lists,
+// the last value (from the upstream that served the response) is also added as <field>_last.
+func addList(g GELFMessage, field string, fType string, s string) {
+	if fType == "list" {
+		s = strings.ReplaceAll(s, " : ", ",")
+	}
+
+	var items []string
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ':' && fType != "list" }) {
+		item = strings.TrimSpace(item)
+		if item != "" && item != "-" {
+			items = append(items, item)
+		}
+	}
+
+	if len(items) == 0 {
+		g[field] = "-"
+		return
+	}
+	g[field] = strings.Join(items, ",")
+
+	switch fType {
+	case "intlist":
+		g[field+"_last"] = string2Int(items[len(items)-1])
+	case "floatlist":
+		g[field+"_last"] = string2Float(items[len(items)-1])
+	}
+}
+
 // emptyString returns a cleaned string or "-" if empty
 func emptyString(s string) string {
 	r := strings.TrimSpace(s)
@@ -0,0 +1,42 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package parse
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAddList(t *testing.T) {
+	tests := []struct {
+		fType string
+		in    string
+		want  string
+		last  string // <field>_last, or empty if not added
+	}{
+		{"list", "10.0.0.1:80, 10.0.0.2:80 : 10.0.0.3:80", "10.0.0.1:80,10.0.0.2:80,10.0.0.3:80", ""},
+		{"list", "unix:/run/php.sock", "unix:/run/php.sock", ""},
+		{"list", "-", "-", ""},
+		{"list", "", "-", ""},
+		{"floatlist", "0.004, 0.002 : 0.010", "0.004,0.002,0.010", "0.01"},
+		{"floatlist", "0.004", "0.004", "0.004"},
+		{"intlist", "502, 200", "502,200", "200"},
+		{"intlist", "502 : -", "502", "502"},
+	}
+	for _, tt := range tests {
+		g := GELFMessage{}
+		addList(g, "_f", tt.fType, tt.in)
+		if got := fmt.Sprint(g["_f"]); got != tt.want {
+			t.Errorf("addList(%s, %q) = %q, want %q", tt.fType, tt.in, got, tt.want)
+		}
+		last, ok := g["_f_last"]
+		if tt.last == "" && ok {
+			t.Errorf("addList(%s, %q) added _f_last = %v", tt.fType, tt.in, last)
+		}
+		if tt.last != "" && fmt.Sprint(last) != tt.last {
+			t.Errorf("addList(%s, %q) _f_last = %v, want %s", tt.fType, tt.in, last, tt.last)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"log2sqs/config"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// condition is a compiled ConditionDef
+type condition struct {
+	field       string
+	equals      string
+	regex       *regexp.Regexp
+	network     *net.IPNet
+	greaterThan *float64
+	lessThan    *float64
+	exists      *bool
+	level       int // -1 if not set
+	all         []*condition
+	any         []*condition
+	not         *condition
+}
+
+// newCondition compiles a condition
+func newCondition(def *config.ConditionDef) (*condition, error) {
+	c := &condition{field: def.Field, equals: def.Equals, greaterThan: def.GreaterThan, lessThan: def.LessThan,
+		exists: def.Exists, level: -1}
+
+	if c.field == "" {
+		if def.Equals != "" || def.Regex != "" || def.CIDR != "" || def.GreaterThan != nil || def.LessThan != nil || def.Exists != nil {
+			return nil, errors.New("condition field cannot be empty")
+		}
+		if def.Level == "" && len(def.All) == 0 && len(def.Any) == 0 && def.Not == nil {
+			return nil, errors.New("condition cannot be empty")
+		}
+	}
+
+	if def.Regex != "" {
+		r, err := regexp.Compile(def.Regex)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("condition regex failed to compile: %s", err.Error()))
+		}
+		c.regex = r
+	}
+
+	if def.CIDR != "" {
+		network, err := global.ParseNetwork(def.CIDR)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid condition CIDR %s: %s", def.CIDR, err.Error()))
+		}
+		c.network = network
+	}
+
+	if def.Level != "" {
+		level, ok := parseLevel(def.Level)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("unknown condition level %s", def.Level))
+		}
+		c.level = level
+	}
+
+	for i := range def.All {
+		sub, err := newCondition(&def.All[i])
+		if err != nil {
+			return nil, err
+		}
+		c.all = append(c.all, sub)
+	}
+	for i := range def.Any {
+		sub, err := newCondition(&def.Any[i])
+		if err != nil {
+			return nil, err
+		}
+		c.any = append(c.any, sub)
+	}
+	if def.Not != nil {
+		sub, err := newCondition(def.Not)
+		if err != nil {
+			return nil, err
+		}
+		c.not = sub
+	}
+	return c, nil
+}
+
+// match returns true if the event matches the condition. A nil condition matches every event.
+func (c *condition) match(g parse.GELFMessage) bool {
+	if c == nil {
+		return true
+	}
+
+	if c.field != "" && !c.matchField(g) {
+		return false
+	}
+
+	// Events without a level are treated as informational, as they are when buffered
+	if c.level >= 0 {
+		level, ok := fieldNumber(g["level"])
+		if !ok {
+			level = global.INFO
+		}
+		if level > float64(c.level) {
+			return false
+		}
+	}
+
+	for _, sub := range c.all {
+		if !sub.match(g) {
+			return false
+		}
+	}
+	if len(c.any) > 0 {
+		found := false
+		for _, sub := range c.any {
+			if sub.match(g) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.not != nil && c.not.match(g) {
+		return false
+	}
+	return true
+}
+
+// matchField returns true if the field passes the tests that are set
+func (c *condition) matchField(g parse.GELFMessage) bool {
+	v, ok := g[c.field]
+	if c.exists != nil && *c.exists != ok {
+		return false
+	}
+	if c.equals == "" && c.regex == nil && c.network == nil && c.greaterThan == nil && c.lessThan == nil {
+		return ok || c.exists != nil
+	}
+	if !ok {
+		return false
+	}
+
+	s := fieldString(v)
+	if c.equals != "" && s != c.equals {
+		return false
+	}
+	if c.regex != nil && !c.regex.MatchString(s) {
+		return false
+	}
+	if c.network != nil {
+		ip := net.ParseIP(s)
+		if ip == nil || !c.network.Contains(ip) {
+			return false
+		}
+	}
+	if c.greaterThan != nil || c.lessThan != nil {
+		n, ok := fieldNumber(v)
+		if !ok || (c.greaterThan != nil && n <= *c.greaterThan) || (c.lessThan != nil && n >= *c.lessThan) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLevel converts a level name such as warning, or a number from 0 to 7, to a level
+func parseLevel(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, n >= global.EMERG && n <= global.DEBUG
+	}
+	for level := global.EMERG; level <= global.DEBUG; level++ {
+		if strings.EqualFold(s, global.GetLevel(level)) {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// fieldString returns the value of a field as a string. Numbers are formatted without exponents.
+func fieldString(v interface{}) string {
+	switch r := v.(type) {
+	case string:
+		return r
+	case float64:
+		return strconv.FormatFloat(r, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(r)
+	}
+}
+
+// fieldNumber returns the value of a field as a number
+func fieldNumber(v interface{}) (float64, bool) {
+	switch r := v.(type) {
+	case float64:
+		return r, true
+	case int:
+		return float64(r), true
+	case int64:
+		return float64(r), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(r), 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
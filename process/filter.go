@@ -0,0 +1,153 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"log2sqs/config"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// ErrFiltered is returned for an event that a filter discarded
+var ErrFiltered = errors.New("event discarded by filter")
+
+// filter is a compiled FilterDef
+type filter struct {
+	name string
+	keep bool // keep only events that match, rather than dropping them
+	cond *condition
+}
+
+// sourceFilters are the filters for syslog messages from a sender
+type sourceFilters struct {
+	network *net.IPNet
+	filters []*filter
+}
+
+// The configured filters, which are not changed after Load
+var globalFilters []*filter
+var fileFilters map[string][]*filter
+var syslogFilters []sourceFilters
+
+// Number of events discarded per filter since the last report
+var filteredMX = sync.Mutex{}
+var filtered = make(map[string]int)
+
+// loadFilters compiles the global, input file and syslog source filters
+func loadFilters() error {
+	g, err := newFilters(config.Config.Filters, "filter")
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string][]*filter)
+	for _, f := range config.Config.InputFiles {
+		filters, err := newFilters(f.Filters, f.Name+" filter")
+		if err != nil {
+			return err
+		}
+		files[f.Name] = filters
+	}
+
+	// Messages use the settings of the first source that matches, as they do for time zones
+	var sources []sourceFilters
+	for _, s := range config.Config.SyslogSources {
+		network, err := global.ParseNetwork(s.Source)
+		if err != nil {
+			if len(s.Filters) > 0 {
+				return errors.New(fmt.Sprintf("invalid syslog source %s: %s", s.Source, err.Error()))
+			}
+			continue
+		}
+		filters, err := newFilters(s.Filters, s.Source+" filter")
+		if err != nil {
+			return err
+		}
+		sources = append(sources, sourceFilters{network: network, filters: filters})
+	}
+
+	globalFilters = g
+	fileFilters = files
+	syslogFilters = sources
+	return nil
+}
+
+// newFilters compiles filter definitions. Filters without a name are named after the scope
+// and their position, such as "filter 2".
+func newFilters(defs []config.FilterDef, scope string) ([]*filter, error) {
+	var filters []*filter
+	for i, def := range defs {
+		f := &filter{name: def.Name}
+		if f.name == "" {
+			f.name = fmt.Sprintf("%s %d", scope, i+1)
+		}
+
+		switch strings.ToLower(def.Action) {
+		case "", "drop":
+		case "keep":
+			f.keep = true
+		default:
+			return nil, errors.New(fmt.Sprintf("%s: unknown action %s", f.name, def.Action))
+		}
+
+		if def.If == nil {
+			return nil, errors.New(fmt.Sprintf("%s: condition cannot be empty", f.name))
+		}
+		c, err := newCondition(def.If)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: %s", f.name, err.Error()))
+		}
+		f.cond = c
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// inputFilters returns the filters for the input after the global filters
+func inputFilters(in Input) []*filter {
+	if in.File != "" {
+		return fileFilters[in.File]
+	}
+
+	ip := net.ParseIP(in.SourceIP)
+	if ip == nil {
+		return nil
+	}
+	for _, s := range syslogFilters {
+		if s.network.Contains(ip) {
+			return s.filters
+		}
+	}
+	return nil
+}
+
+// discard returns true if one of the filters discards the event, and counts the event
+// against that filter
+func discard(filters []*filter, g parse.GELFMessage) bool {
+	for _, f := range filters {
+		if f.cond.match(g) != f.keep {
+			filteredMX.Lock()
+			filtered[f.name]++
+			filteredMX.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// Filtered returns the number of events discarded by each filter since it was last called
+func Filtered() map[string]int {
+	filteredMX.Lock()
+	defer filteredMX.Unlock()
+	counts := filtered
+	filtered = make(map[string]int)
+	return counts
+}
@@ -0,0 +1,277 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"log2sqs/config"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// Input describes where an event came from
+type Input struct {
+	File     string // name of the log file the event was read from
+	SourceIP string // address of the syslog sender
+	Internal bool   // event generated by log2sqs
+}
+
+// stage is a compiled ProcessorDef
+type stage struct {
+	def      config.ProcessorDef
+	cond     *condition
+	template *template.Template
+	redact   *redactor
+	apply    func(s *stage, g parse.GELFMessage)
+}
+
+// Stage types and the functions that apply them
+var stageTypes = map[string]func(s *stage, g parse.GELFMessage){
+	"add":            addStage,
+	"set_if_missing": setIfMissingStage,
+	"rename":         renameStage,
+	"copy":           copyStage,
+	"remove":         removeStage,
+	"lowercase":      lowercaseStage,
+	"split":          splitStage,
+	"convert":        convertStage,
+	"template":       templateStage,
+	"redact":         redactStage,
+}
+
+// The configured stages, which are not changed after Load
+var pipeline []*stage
+
+// Load compiles the processors and filters in config.Config
+func Load() error {
+	var stages []*stage
+	for i, def := range config.Config.Processors {
+		s, err := newStage(def)
+		if err != nil {
+			return errors.New(fmt.Sprintf("processor %d (%s): %s", i+1, def.Type, err.Error()))
+		}
+		stages = append(stages, s)
+	}
+	pipeline = stages
+	return loadFilters()
+}
+
+// newStage checks and compiles a processor definition
+func newStage(def config.ProcessorDef) (*stage, error) {
+	def.Type = strings.ToLower(def.Type)
+	apply, ok := stageTypes[def.Type]
+	if !ok {
+		return nil, errors.New("unknown processor type")
+	}
+	s := &stage{def: def, apply: apply}
+
+	switch def.Type {
+	case "add", "set_if_missing", "rename", "copy":
+		if len(def.Values) == 0 {
+			return nil, errors.New("values cannot be empty")
+		}
+	case "template":
+		if def.Target == "" {
+			return nil, errors.New("target cannot be empty")
+		}
+		t, err := template.New(def.Target).Option("missingkey=zero").Parse(def.Template)
+		if err != nil {
+			return nil, err
+		}
+		s.template = t
+	default:
+		if len(def.Fields) == 0 {
+			return nil, errors.New("fields cannot be empty")
+		}
+	}
+
+	if def.Type == "convert" {
+		if def.FieldType == "" {
+			return nil, errors.New("field type cannot be empty")
+		}
+		switch strings.ToLower(def.OnError) {
+		case "", "drop", "raw":
+		default:
+			return nil, errors.New(fmt.Sprintf("unknown OnError %s", def.OnError))
+		}
+	}
+
+	if def.Type == "redact" {
+		r, err := newRedactor(def)
+		if err != nil {
+			return nil, err
+		}
+		s.redact = r
+	}
+
+	if def.If != nil {
+		c, err := newCondition(def.If)
+		if err != nil {
+			return nil, err
+		}
+		s.cond = c
+	}
+	return s, nil
+}
+
+// Apply adds the fields that describe the input and the static AddFields to an event, passes
+// it through the configured stages in order and then applies the global and input filters.
+// Every input calls Apply before output, and discards the event if it returns false. Internal
+// events are not filtered.
+func Apply(g parse.GELFMessage, in Input) bool {
+	if in.File != "" {
+		g["_log_file"] = in.File
+		g["_log_source"] = config.Config.Hostname
+	} else {
+		g["_event_source_ip"] = EventSourceIP(in.SourceIP)
+	}
+
+	for key, value := range config.Config.AddFields {
+		g[key] = value
+	}
+
+	for _, s := range pipeline {
+		if s.cond.match(g) {
+			s.apply(s, g)
+		}
+	}
+
+	if in.Internal {
+		return true
+	}
+	return !discard(globalFilters, g) && !discard(inputFilters(in), g)
+}
+
+// EventSourceIP returns the _event_source_ip of an event received from srcIP, or generated
+// locally if srcIP is empty. SyslogOverrideSourceIP replaces every address, and the host's
+// outbound address is used for local events and, if SyslogReplaceLocalhost is set, 127.0.0.1.
+func EventSourceIP(srcIP string) string {
+	if config.Config.SyslogOverrideSourceIP != "" {
+		return config.Config.SyslogOverrideSourceIP
+	}
+
+	if srcIP == "" || (config.Config.SyslogReplaceLocalhost && srcIP == "127.0.0.1") {
+		if ip := global.GetOutboundIP(); ip != "" {
+			return ip
+		}
+	}
+	return srcIP
+}
+
+// sortedKeys returns the keys of the map in order, so stages are applied consistently
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// addStage sets fields to static values
+func addStage(s *stage, g parse.GELFMessage) {
+	for k, v := range s.def.Values {
+		g[k] = v
+	}
+}
+
+// setIfMissingStage sets fields that do not exist to static values
+func setIfMissingStage(s *stage, g parse.GELFMessage) {
+	for k, v := range s.def.Values {
+		if _, ok := g[k]; !ok {
+			g[k] = v
+		}
+	}
+}
+
+// renameStage moves fields to new names
+func renameStage(s *stage, g parse.GELFMessage) {
+	for _, from := range sortedKeys(s.def.Values) {
+		if v, ok := g[from]; ok {
+			delete(g, from)
+			g[s.def.Values[from]] = v
+		}
+	}
+}
+
+// copyStage copies fields to new names
+func copyStage(s *stage, g parse.GELFMessage) {
+	for _, from := range sortedKeys(s.def.Values) {
+		if v, ok := g[from]; ok {
+			g[s.def.Values[from]] = v
+		}
+	}
+}
+
+// removeStage removes fields
+func removeStage(s *stage, g parse.GELFMessage) {
+	for _, f := range s.def.Fields {
+		delete(g, f)
+	}
+}
+
+// lowercaseStage converts string fields to lower case
+func lowercaseStage(s *stage, g parse.GELFMessage) {
+	for _, f := range s.def.Fields {
+		if v, ok := g[f].(string); ok {
+			g[f] = strings.ToLower(v)
+		}
+	}
+}
+
+// splitStage splits a string field into the target fields, or <field>_1, <field>_2, etc.
+func splitStage(s *stage, g parse.GELFMessage) {
+	sep := s.def.Separator
+	if sep == "" {
+		sep = ","
+	}
+
+	for _, f := range s.def.Fields {
+		v, ok := g[f].(string)
+		if !ok {
+			continue
+		}
+
+		for i, part := range strings.Split(v, sep) {
+			name := fmt.Sprintf("%s_%d", f, i+1)
+			if len(s.def.Targets) > 0 {
+				if i >= len(s.def.Targets) {
+					break
+				}
+				name = s.def.Targets[i]
+			}
+			g[name] = strings.TrimSpace(part)
+		}
+	}
+}
+
+// convertStage converts fields to another type, such as a string to a number
+func convertStage(s *stage, g parse.GELFMessage) {
+	for _, f := range s.def.Fields {
+		v, ok := g[f]
+		if !ok {
+			continue
+		}
+
+		field := config.RegexField{Field: f, FType: s.def.FieldType, OnError: s.def.OnError}
+		_ = parse.ConvertField(g, field, fieldString(v))
+	}
+}
+
+// templateStage sets the target field to the rendered template
+func templateStage(s *stage, g parse.GELFMessage) {
+	var buf bytes.Buffer
+	err := s.template.Execute(&buf, map[string]interface{}(g))
+	if err != nil {
+		return
+	}
+	g[s.def.Target] = strings.ReplaceAll(buf.String(), "<no value>", "")
+}
@@ -0,0 +1,363 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"log2sqs/config"
+	"log2sqs/parse"
+)
+
+// Redaction modes
+const (
+	redactMask    = "mask"
+	redactHash    = "hash"
+	redactPartial = "partial"
+)
+
+// Default replacement for the mask mode
+const defaultMask = "[REDACTED]"
+
+// detector finds sensitive values. If the regex has a group, only the first group is redacted.
+type detector struct {
+	regex   *regexp.Regexp
+	valid   func(s string) bool     // rejects false positives, or nil
+	split   func(s string) [][2]int // finds the values within a match, or nil for the whole match
+	partial func(s string) string   // masks part of the value, or nil to keep the last 4 characters
+}
+
+// Built-in detectors
+var detectors = map[string]*detector{
+	"email": {
+		// Includes addresses with the @ URL-encoded, as in query strings
+		regex:   regexp.MustCompile(`[A-Za-z0-9._+-]+(?:@|%40)[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		partial: partialEmail,
+	},
+	"card": {
+		// Also matches the numbers around a card number, which split removes
+		regex: regexp.MustCompile(`\b\d(?:[ -]?\d){12,}\b`),
+		split: cardNumbers,
+	},
+	"ipv4": {
+		regex:   regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+		partial: partialIPv4,
+	},
+	"ipv6": {
+		// Addresses with an embedded IPv4 address, such as ::ffff:10.0.0.1, are tried first
+		regex:   regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){1,6}:(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`),
+		valid:   validIPv6,
+		partial: partialIPv6,
+	},
+	"jwt": {
+		regex: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	"aws_key": {
+		regex: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`),
+	},
+	"bearer": {
+		regex: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)`),
+	},
+}
+
+// Matches a group of digits in a card number
+var digitGroupRegex = regexp.MustCompile(`\d+`)
+
+// Detectors that are enabled by another name
+var detectorGroups = map[string][]string{
+	"ip": {"ipv4", "ipv6"},
+}
+
+// redactor is the compiled configuration of a redact stage
+type redactor struct {
+	detectors []*detector
+	mode      string
+	mask      string
+	salt      string
+}
+
+// span is the location of a value to redact
+type span struct {
+	start, end int
+	d          *detector
+}
+
+// newRedactor checks and compiles the detectors and mode of a redact stage
+func newRedactor(def config.ProcessorDef) (*redactor, error) {
+	r := &redactor{mode: strings.ToLower(def.Mode), mask: def.Mask, salt: def.Salt}
+
+	for _, name := range def.Detectors {
+		name = strings.ToLower(name)
+		names, ok := detectorGroups[name]
+		if !ok {
+			names = []string{name}
+		}
+		for _, n := range names {
+			d, ok := detectors[n]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("unknown detector %s", name))
+			}
+			r.detectors = append(r.detectors, d)
+		}
+	}
+
+	for _, p := range def.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("pattern failed to compile: %s", err.Error()))
+		}
+		r.detectors = append(r.detectors, &detector{regex: re})
+	}
+
+	if len(r.detectors) == 0 {
+		return nil, errors.New("detectors and patterns cannot both be empty")
+	}
+
+	switch r.mode {
+	case "":
+		r.mode = redactMask
+	case redactMask, redactPartial:
+	case redactHash:
+		if r.salt == "" {
+			return nil, errors.New("salt cannot be empty for hash")
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown mode %s", def.Mode))
+	}
+
+	if r.mask == "" {
+		r.mask = defaultMask
+	}
+	return r, nil
+}
+
+// redactStage replaces the sensitive values in string fields
+func redactStage(s *stage, g parse.GELFMessage) {
+	for _, f := range s.def.Fields {
+		if v, ok := g[f].(string); ok {
+			g[f] = s.redact.redact(v)
+		}
+	}
+}
+
+// Redact applies every redact processor to a line that could not be parsed, such as one that is
+// dead-lettered. The line may hold any field, so the Fields and If conditions are ignored.
+func Redact(s string) string {
+	for _, st := range pipeline {
+		if st.redact != nil {
+			s = st.redact.redact(s)
+		}
+	}
+	return s
+}
+
+// redact returns s with the sensitive values replaced. Values are found in the original string
+// by every detector before any are replaced, so a replacement is never matched again. Where
+// values overlap, the one that starts first, or the longer one, is redacted.
+func (r *redactor) redact(s string) string {
+	var spans []span
+	for _, d := range r.detectors {
+		for _, m := range d.regex.FindAllStringSubmatchIndex(s, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if start == end || (d.valid != nil && !d.valid(s[start:end])) {
+				continue
+			}
+			if d.split == nil {
+				spans = append(spans, span{start: start, end: end, d: d})
+				continue
+			}
+			for _, v := range d.split(s[start:end]) {
+				spans = append(spans, span{start: start + v[0], end: start + v[1], d: d})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return s
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+
+	var b strings.Builder
+	pos := 0
+	for _, sp := range spans {
+		if sp.start < pos {
+			continue
+		}
+		b.WriteString(s[pos:sp.start])
+		b.WriteString(r.replace(s[sp.start:sp.end], sp.d))
+		pos = sp.end
+	}
+	b.WriteString(s[pos:])
+	return b.String()
+}
+
+// replace returns the replacement for a sensitive value
+func (r *redactor) replace(value string, d *detector) string {
+	switch r.mode {
+	case redactHash:
+		// A salted hash hides the value but still allows events to be correlated
+		sum := sha256.Sum256([]byte(r.salt + value))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case redactPartial:
+		if d.partial != nil {
+			return d.partial(value)
+		}
+		return maskAlnum(value, 0, 4)
+	default:
+		return r.mask
+	}
+}
+
+// maskAlnum replaces the letters and digits of s with *, except the first keepFirst and last
+// keepLast of them. Other characters, such as separators, are kept to preserve the format.
+func maskAlnum(s string, keepFirst int, keepLast int) string {
+	total := 0
+	for _, c := range s {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			total++
+		}
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range s {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			n++
+			if n > keepFirst && n <= total-keepLast {
+				c = '*'
+			}
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// partialEmail masks the local part of an email address except its first character
+func partialEmail(s string) string {
+	i := strings.Index(s, "@")
+	if i < 0 {
+		i = strings.Index(s, "%40")
+	}
+	if i <= 0 {
+		return maskAlnum(s, 0, 4)
+	}
+	return s[:1] + strings.Repeat("*", len(s[1:i])) + s[i:]
+}
+
+// partialIPv4 masks the last two octets of an IPv4 address
+func partialIPv4(s string) string {
+	octets := strings.Split(s, ".")
+	for i := 2; i < len(octets); i++ {
+		octets[i] = strings.Repeat("*", len(octets[i]))
+	}
+	return strings.Join(octets, ".")
+}
+
+// partialIPv6 masks all but the first three groups of an IPv6 address. The groups are counted
+// in the expanded address, so the groups after a :: are masked even if there are fewer than
+// three before it. An embedded IPv4 address is masked as an IPv4 address.
+func partialIPv6(s string) string {
+	head, tail := s, ""
+	i := strings.Index(s, "::")
+	if i >= 0 {
+		head, tail = s[:i], s[i+2:]
+	}
+
+	mask := func(part string, pos int) string {
+		if part == "" {
+			return part
+		}
+		groups := strings.Split(part, ":")
+		for j, group := range groups {
+			if strings.Contains(group, ".") {
+				groups[j] = partialIPv4(group)
+			} else if pos+j >= 3 {
+				groups[j] = strings.Repeat("*", len(group))
+			}
+		}
+		return strings.Join(groups, ":")
+	}
+
+	if i < 0 {
+		return mask(head, 0)
+	}
+
+	// The groups after the :: end the 8 groups of the address, an IPv4 address counting as two
+	n := 0
+	if tail != "" {
+		n = strings.Count(tail, ":") + 1
+		if strings.Contains(tail, ".") {
+			n++
+		}
+	}
+	return mask(head, 0) + "::" + mask(tail, 8-n)
+}
+
+// validIPv6 returns true if s is an IPv6 address, rather than a time or MAC address
+func validIPv6(s string) bool {
+	return net.ParseIP(s) != nil && strings.ContainsAny(s, "0123456789abcdefABCDEF")
+}
+
+// cardNumbers returns the card numbers in a run of digit groups. A card number is 13 to 19
+// digits in whole groups that pass the Luhn check, so the numbers before or after it, such as
+// an expiry date or amount, are not redacted and do not hide it. The longest number is used.
+func cardNumbers(s string) [][2]int {
+	groups := digitGroupRegex.FindAllStringIndex(s, -1)
+
+	var numbers [][2]int
+	for i := 0; i < len(groups); i++ {
+		for j := len(groups) - 1; j >= i; j-- {
+			value := s[groups[i][0]:groups[j][1]]
+			if luhn(value) {
+				numbers = append(numbers, [2]int{groups[i][0], groups[j][1]})
+				i = j
+				break
+			}
+		}
+	}
+	return numbers
+}
+
+// luhn returns true if the digits in s are a valid card number
+func luhn(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package process
+
+import (
+	"testing"
+
+	"log2sqs/config"
+)
+
+// testRedactor compiles a redactor for the detectors and mode
+func testRedactor(t *testing.T, mode string, detectors ...string) *redactor {
+	r, err := newRedactor(config.ProcessorDef{Type: "redact", Detectors: detectors, Mode: mode})
+	if err != nil {
+		t.Fatalf("newRedactor: %s", err)
+	}
+	return r
+}
+
+func TestRedactCard(t *testing.T) {
+	r := testRedactor(t, redactMask, "card")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"card 4111111111111111", "card [REDACTED]"},
+		{"card 4111111111111111 12", "card [REDACTED] 12"},
+		{"card 4111 1111 1111 1111 99 paid", "card [REDACTED] 99 paid"},
+		{"card 4111-1111-1111-1111", "card [REDACTED]"},
+		{"order 12 4111 1111 1111 1111", "order 12 [REDACTED]"},
+		{"cards 4111111111111111 5500000000000004", "cards [REDACTED] [REDACTED]"},
+		{"id 4111111111111112", "id 4111111111111112"},
+		{"phone 555 1234 5678 9012", "phone 555 1234 5678 9012"},
+	}
+	for _, tt := range tests {
+		if got := r.redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactIP(t *testing.T) {
+	r := testRedactor(t, redactMask, "ip")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"from 10.1.2.3 port 22", "from [REDACTED] port 22"},
+		{"from ::ffff:10.0.0.1 port 22", "from [REDACTED] port 22"},
+		{"from 64:ff9b::192.0.2.33", "from [REDACTED]"},
+		{"from 2001:db8::8a2e:370:7334", "from [REDACTED]"},
+		{"from fe80::1", "from [REDACTED]"},
+		{"at 10:30:00", "at 10:30:00"},
+	}
+	for _, tt := range tests {
+		if got := r.redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactPartial(t *testing.T) {
+	r := testRedactor(t, redactPartial, "email", "card", "ip")
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"user alice@example.com", "user a****@example.com"},
+		{"card 4111 1111 1111 1111", "card **** **** **** 1111"},
+		{"from 192.168.10.20", "from 192.168.**.**"},
+		{"from 2001:db8:85a3::8a2e:370:7334", "from 2001:db8:85a3::****:***:****"},
+		{"from 2001:db8::8a2e:370:7334", "from 2001:db8::****:***:****"},
+		{"from fe80::1", "from fe80::*"},
+		{"from ::1", "from ::*"},
+		{"from ::ffff:10.0.0.1", "from ::****:10.0.*.*"},
+	}
+	for _, tt := range tests {
+		if got := r.redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactRaw(t *testing.T) {
+	config.Config = config.Data{}
+	config.Config.Processors = []config.ProcessorDef{
+		{Type: "redact", Fields: []string{"short_message"}, Detectors: []string{"email"}},
+		{Type: "redact", Fields: []string{"_query"}, Patterns: []string{`token=(\w+)`}, Mode: redactPartial},
+	}
+	if err := Load(); err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	defer func() {
+		config.Config = config.Data{}
+		_ = Load()
+	}()
+
+	got := Redact("bob@example.com GET /?token=abcdef123456")
+	want := "[REDACTED] GET /?token=********3456"
+	if got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+}
@@ -13,21 +13,24 @@ import (
 
 	"log2sqs/config"
 	"log2sqs/event"
+	"log2sqs/global"
 	"log2sqs/parse"
+	"log2sqs/process"
 )
 
+// Format is recorded as the format of dead-lettered syslog messages
+const Format = "syslog"
+
 func syslogProcess(buf []byte, srcIP string) error {
 
 	// Parse the message
-	g := parse.GELFMessage{}
-	err := parseSyslog(buf, srcIP, g)
-	if err != nil {
-		return errors.New(fmt.Sprintf("error parsing syslog message: %s", err.Error()))
+	g, err := Parse(buf, srcIP)
+	if errors.Is(err, process.ErrFiltered) {
+		return nil
 	}
-
-	// Add any static fields
-	for key, value := range config.Config.AddFields {
-		g[key] = value
+	if err != nil {
+		event.DeadLetterRaw(srcIP, Format, string(buf), err)
+		return err
 	}
 
 	// Marshal JSON for queue
@@ -41,10 +44,29 @@ func syslogProcess(buf []byte, srcIP string) error {
 	}
 
 	// Add to memory buffer
-	event.Add(gBytes)
+	level := global.INFO
+	if gExists(g, "level") {
+		level = int(gGetInt(g, "level"))
+	}
+	event.Add(gBytes, srcIP, level)
 	return nil
 }
 
+// Parse converts a syslog message received from srcIP into a GELF message and passes it
+// through the processing pipeline. It returns process.ErrFiltered if a filter discards it.
+func Parse(buf []byte, srcIP string) (parse.GELFMessage, error) {
+	g := parse.GELFMessage{}
+	err := parseSyslog(buf, srcIP, g)
+	if err != nil {
+		return g, errors.New(fmt.Sprintf("error parsing syslog message: %s", err.Error()))
+	}
+
+	if !process.Apply(g, process.Input{SourceIP: srcIP}) {
+		return g, process.ErrFiltered
+	}
+	return g, nil
+}
+
 // safeAddrString returns a string or "" if addr is nil
 func safeAddrString(addr net.Addr) string {
 	if addr == nil {
@@ -12,7 +12,6 @@ import (
 	"log2sqs/config"
 	"log2sqs/global"
 	"log2sqs/parse"
-	"math"
 	"strconv"
 )
 
@@ -81,9 +80,7 @@ func gelf(buf []byte, srcIP string, g parse.GELFMessage) error {
 
 	// Sanity check timestamp
 	if gExists(j, "timestamp") {
-		if math.Abs(float64(gGetInt(j, "timestamp"))-global.TimeStamp()) > 240 {
-			g["timestamp"] = global.TimeStamp()
-		}
+		checkTimestamp(g, gGetFloat(j, "timestamp"))
 	} else {
 		// Timestamp is missing, so just set it
 		g["timestamp"] = global.TimeStamp()
@@ -92,21 +89,6 @@ func gelf(buf []byte, srcIP string, g parse.GELFMessage) error {
 	// Add hostname and protocol
 	g["_via_hostname"] = config.Config.Hostname
 	g["_via_proto"] = "syslog_gelf"
-
-	// Add source IP
-	if config.Config.SyslogOverrideSourceIP != "" {
-		g["_event_source_ip"] = config.Config.SyslogOverrideSourceIP
-	} else {
-		if config.Config.SyslogReplaceLocalhost && srcIP == "127.0.0.1" {
-			g["_event_source_ip"] = global.GetOutboundIP()
-			if g["_event_source_ip"] == "" {
-				g["_event_source_ip"] = srcIP
-			}
-		} else {
-			g["_event_source_ip"] = srcIP
-		}
-	}
-
 	return nil
 }
 
@@ -144,6 +126,23 @@ func gGetInt(j parse.GELFMessage, k string) int64 {
 	return n
 }
 
+// gGetFloat safely retrieves a numeric value, such as a timestamp with decimals, or returns 0
+func gGetFloat(j parse.GELFMessage, k string) float64 {
+	val, ok := j[k]
+	if !ok {
+		return 0
+	}
+
+	s := fmt.Sprintf("%v", val)
+
+	// Convert string to float64
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 // gGetStr safely returns the string or ""
 func gGetStr(j parse.GELFMessage, k string) string {
 	val, ok := j[k]
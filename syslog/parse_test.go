@@ -0,0 +1,42 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"testing"
+
+	"log2sqs/config"
+	"log2sqs/parse"
+)
+
+func TestParseShortMessages(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+
+	tests := []struct {
+		in     string
+		format string
+	}{
+		{"", "unknown"},
+		{"x", "unknown"},
+		{"just text", "unknown"},
+		{"<", "unknown"},
+		{"<34", "unknown"},
+		{"<34>", "RFC3164"},
+		{"<34>1", "RFC3164"},
+		{"<34>hi", "RFC3164"},
+		{"<999>too big", "unknown"},
+	}
+	for _, tt := range tests {
+		g := parse.GELFMessage{}
+		if err := parseSyslog([]byte(tt.in), "10.0.0.1", g); err != nil {
+			t.Errorf("parseSyslog(%q): %s", tt.in, err)
+			continue
+		}
+		if g["_original_format"] != tt.format {
+			t.Errorf("parseSyslog(%q) format = %v, want %s", tt.in, g["_original_format"], tt.format)
+		}
+	}
+}
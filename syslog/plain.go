@@ -6,7 +6,6 @@ package syslog
 
 import (
 	"strings"
-	"time"
 
 	"log2sqs/config"
 	"log2sqs/global"
@@ -22,20 +21,8 @@ func plainText(buf []byte, srcIP string, g parse.GELFMessage) error {
 	g["host"] = srcIP
 	g["short_message"] = strings.TrimSuffix(string(buf), "\n")
 	g["_original_format"] = "unknown"
-	g["timestamp"] = time.Now().Unix()
-
-	if config.Config.SyslogOverrideSourceIP != "" {
-		g["_event_source_ip"] = config.Config.SyslogOverrideSourceIP
-	} else {
-		if config.Config.SyslogReplaceLocalhost && srcIP == "127.0.0.1" {
-			g["_event_source_ip"] = global.GetOutboundIP()
-			if g["_event_source_ip"] == "" {
-				g["_event_source_ip"] = srcIP
-			}
-		} else {
-			g["_event_source_ip"] = srcIP
-		}
-	}
+	g["timestamp"] = global.TimeStamp()
+	_ = parse.ParseSecurityEvent(string(buf), g)
 
 	if config.Config.SyslogFullMessage {
 		g["full_message"] = strings.TrimSuffix(string(buf), "\n")
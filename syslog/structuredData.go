@@ -0,0 +1,135 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"log2sqs/config"
+	"log2sqs/parse"
+)
+
+// Characters that can not be used in GELF field names
+var sdNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// sdParam is a parameter of an SD-ELEMENT
+type sdParam struct {
+	name  string
+	value string
+}
+
+// sdElement is an SD-ELEMENT such as [origin ip="10.0.0.1"]
+type sdElement struct {
+	id     string
+	params []sdParam
+}
+
+// addStructuredData adds the RFC5424 structured data as _sd_<id>_<param> fields. Repeated
+// parameters are joined with commas, and the IDs of all elements are listed in _sd_ids. The raw
+// string is kept in _structured_data if SyslogStructuredDataRaw is set or it can not be parsed.
+func addStructuredData(g parse.GELFMessage, sd string) {
+	if sd == "" || sd == "-" {
+		return
+	}
+
+	elements, err := parseStructuredData(sd)
+	if err != nil || config.Config.SyslogStructuredDataRaw {
+		g["_structured_data"] = sd
+	}
+	if err != nil {
+		return
+	}
+
+	var ids []string
+	for _, e := range elements {
+		ids = append(ids, e.id)
+		prefix := "_sd_" + sdNameRegex.ReplaceAllString(e.id, "_") + "_"
+
+		for _, p := range e.params {
+			name := prefix + sdNameRegex.ReplaceAllString(p.name, "_")
+			if v, ok := g[name].(string); ok {
+				g[name] = v + "," + p.value
+			} else {
+				g[name] = p.value
+			}
+		}
+	}
+	g["_sd_ids"] = strings.Join(ids, ",")
+}
+
+// parseStructuredData splits structured data such as [meta sequenceId="1"][origin ip="10.0.0.1"]
+// into elements. The escaped characters \" \\ and \] in parameter values are unescaped.
+func parseStructuredData(s string) ([]sdElement, error) {
+	var elements []sdElement
+
+	i := 0
+	for i < len(s) {
+		if s[i] != '[' {
+			return nil, errors.New("expected [ at start of SD-ELEMENT")
+		}
+		i++
+
+		// The SD-ID ends at a space or the end of the element
+		start := i
+		for i < len(s) && s[i] != ' ' && s[i] != ']' {
+			i++
+		}
+		e := sdElement{id: s[start:i]}
+		if e.id == "" {
+			return nil, errors.New("missing SD-ID")
+		}
+
+		for i < len(s) && s[i] != ']' {
+			// Skip the space before each parameter
+			for i < len(s) && s[i] == ' ' {
+				i++
+			}
+			if i < len(s) && s[i] == ']' {
+				break
+			}
+
+			// PARAM-NAME="PARAM-VALUE"
+			start = i
+			for i < len(s) && s[i] != '=' && s[i] != ' ' && s[i] != ']' {
+				i++
+			}
+			name := s[start:i]
+			if name == "" || i+1 >= len(s) || s[i] != '=' || s[i+1] != '"' {
+				return nil, errors.New("invalid SD-PARAM in " + e.id)
+			}
+			i += 2
+
+			var value strings.Builder
+			closed := false
+			for i < len(s) {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					value.WriteByte(s[i+1])
+					i += 2
+					continue
+				}
+				i++
+				if c == '"' {
+					closed = true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, errors.New("unterminated SD-PARAM value in " + e.id)
+			}
+			e.params = append(e.params, sdParam{name: name, value: value.String()})
+		}
+
+		if i >= len(s) {
+			return nil, errors.New("unterminated SD-ELEMENT " + e.id)
+		}
+		i++
+		elements = append(elements, e)
+	}
+	return elements, nil
+}
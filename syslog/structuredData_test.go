@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"fmt"
+	"testing"
+
+	"log2sqs/config"
+	"log2sqs/parse"
+)
+
+func TestAddStructuredData(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+
+	tests := []struct {
+		in     string
+		fields map[string]string // expected fields, "<none>" for a field that is not added
+	}{
+		{`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"]`,
+			map[string]string{
+				"_sd_exampleSDID_32473_iut":         "3",
+				"_sd_exampleSDID_32473_eventSource": "Application",
+				"_sd_examplePriority_32473_class":   "high",
+				"_sd_ids":                           "exampleSDID@32473,examplePriority@32473",
+				"_structured_data":                  "<none>",
+			}},
+		// Escaped quotes, backslashes and brackets in values
+		{`[app@1 msg="say \"hi\"" path="C:\\Temp\\" rule="a\]b" other="x\y"]`,
+			map[string]string{
+				"_sd_app_1_msg":   `say "hi"`,
+				"_sd_app_1_path":  `C:\Temp\`,
+				"_sd_app_1_rule":  "a]b",
+				"_sd_app_1_other": `x\y`,
+			}},
+		// Repeated parameters, elements without parameters and empty values
+		{`[origin ip="10.0.0.1" ip="2001:db8::1" software="x"][timeQuality][meta sequenceId=""]`,
+			map[string]string{
+				"_sd_origin_ip":       "10.0.0.1,2001:db8::1",
+				"_sd_ids":             "origin,timeQuality,meta",
+				"_sd_meta_sequenceId": "",
+			}},
+		// Truncated and invalid structured data is kept as it is
+		{`[origin ip="10.0.0.1"`, map[string]string{"_structured_data": `[origin ip="10.0.0.1"`, "_sd_origin_ip": "<none>", "_sd_ids": "<none>"}},
+		{`[origin ip="10.0.0.1]`, map[string]string{"_structured_data": `[origin ip="10.0.0.1]`}},
+		{`[origin ip=10.0.0.1]`, map[string]string{"_structured_data": `[origin ip=10.0.0.1]`}},
+		{`[ ip="1"]`, map[string]string{"_structured_data": `[ ip="1"]`}},
+		{`origin`, map[string]string{"_structured_data": "origin"}},
+		{`-`, map[string]string{"_structured_data": "<none>", "_sd_ids": "<none>"}},
+	}
+	for _, tt := range tests {
+		g := parse.GELFMessage{}
+		addStructuredData(g, tt.in)
+		for k, want := range tt.fields {
+			v, ok := g[k]
+			if want == "<none>" {
+				if ok {
+					t.Errorf("addStructuredData(%q)[%s] = %v, want no field", tt.in, k, v)
+				}
+				continue
+			}
+			if !ok || fmt.Sprint(v) != want {
+				t.Errorf("addStructuredData(%q)[%s] = %v, want %s", tt.in, k, v, want)
+			}
+		}
+	}
+
+	// The raw string can be kept as well
+	config.Config.SyslogStructuredDataRaw = true
+	g := parse.GELFMessage{}
+	addStructuredData(g, `[meta sequenceId="1"]`)
+	if g["_structured_data"] != `[meta sequenceId="1"]` || g["_sd_meta_sequenceId"] != "1" {
+		t.Errorf("addStructuredData with SyslogStructuredDataRaw = %v", g)
+	}
+}
+
+func TestParseRFC5424(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.SyslogTimeWindow = 0
+
+	in := `<165>1 2023-10-11T22:14:15.123456Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`
+	g := parse.GELFMessage{}
+	if err := parseSyslog([]byte(in), "10.0.0.1", g); err != nil {
+		t.Fatalf("parseSyslog: %s", err)
+	}
+
+	want := map[string]string{
+		"_original_format":          "RFC5424",
+		"host":                      "mymachine.example.com",
+		"level":                     "5",
+		"_app_name":                 "evntslog",
+		"_proc_id":                  "1234",
+		"_sd_exampleSDID_32473_iut": "3",
+		"short_message":             "An application event",
+	}
+	for k, v := range want {
+		if got := fmt.Sprint(g[k]); got != v {
+			t.Errorf("%s = %s, want %s", k, got, v)
+		}
+	}
+	if g["timestamp"] != 1697062455.123456 {
+		t.Errorf("timestamp = %v, want microseconds kept", g["timestamp"])
+	}
+}
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/event"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// syslogSource holds the settings for messages from a sender
+type syslogSource struct {
+	network  *net.IPNet     // addresses of the sender
+	location *time.Location // time zone of RFC3164 timestamps, or nil for the default
+}
+
+var sourcesOnce sync.Once
+var sources []syslogSource
+var defaultLocation = time.UTC
+
+// loadSources loads the time zones and sender addresses from the configuration
+func loadSources() {
+	if config.Config.SyslogTimezone != "" {
+		loc, err := time.LoadLocation(config.Config.SyslogTimezone)
+		if err != nil {
+			event.Log(fmt.Sprintf("Unknown syslog time zone: %s", config.Config.SyslogTimezone), "", global.ERR)
+		} else {
+			defaultLocation = loc
+		}
+	}
+
+	for _, s := range config.Config.SyslogSources {
+		network, err := global.ParseNetwork(s.Source)
+		if err != nil {
+			event.Log(fmt.Sprintf("Invalid syslog source %s: %s", s.Source, err.Error()), "", global.ERR)
+			continue
+		}
+
+		src := syslogSource{network: network}
+		if s.Timezone != "" {
+			src.location, err = time.LoadLocation(s.Timezone)
+			if err != nil {
+				event.Log(fmt.Sprintf("Unknown time zone for syslog source %s: %s", s.Source, s.Timezone), "", global.ERR)
+				continue
+			}
+		}
+		sources = append(sources, src)
+	}
+}
+
+// findSource returns the settings for the first source that matches the sender, or nil
+func findSource(srcIP string) *syslogSource {
+	sourcesOnce.Do(loadSources)
+
+	ip := net.ParseIP(srcIP)
+	if ip == nil {
+		return nil
+	}
+	for i := range sources {
+		if sources[i].network.Contains(ip) {
+			return &sources[i]
+		}
+	}
+	return nil
+}
+
+// sourceLocation returns the time zone of RFC3164 timestamps from the sender
+func sourceLocation(srcIP string) *time.Location {
+	if s := findSource(srcIP); s != nil && s.location != nil {
+		return s.location
+	}
+	return defaultLocation
+}
+
+// checkTimestamp checks that the timestamp ts of the event is within SyslogTimeWindow seconds of
+// the current time. This safeguards against systems that log in local time instead of UTC with
+// no time zone, or have clocks that are out of whack. Depending on SyslogTimePolicy, a timestamp
+// outside the window is kept, clamped to the window or replaced with the current time, and the
+// original timestamp is kept in _original_timestamp.
+func checkTimestamp(g parse.GELFMessage, ts float64) {
+	window := float64(config.Config.SyslogTimeWindow)
+	now := global.TimeStamp()
+	if window <= 0 || math.Abs(ts-now) <= window {
+		return
+	}
+
+	switch strings.ToLower(config.Config.SyslogTimePolicy) {
+	case "keep":
+		return
+	case "clamp":
+		g["_original_timestamp"] = g["timestamp"]
+		if ts > now {
+			g["timestamp"] = now + window
+		} else {
+			g["timestamp"] = now - window
+		}
+	default:
+		g["_original_timestamp"] = g["timestamp"]
+		g["timestamp"] = now
+	}
+}
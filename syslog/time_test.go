@@ -0,0 +1,107 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// resetSources reloads the time zones and sources from the configuration on next use
+func resetSources() {
+	sourcesOnce = sync.Once{}
+	sources = nil
+	defaultLocation = time.UTC
+}
+
+func TestSourceTimezones(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.SyslogTimeWindow = 0
+	config.Config.SyslogTimezone = "America/New_York"
+	config.Config.SyslogSources = []config.SyslogSourceDef{
+		{Source: "10.1.0.0/16", Timezone: "Europe/Berlin"},
+		{Source: "10.2.0.5"},
+		{Source: "10.2.0.0/16", Timezone: "UTC"},
+	}
+	resetSources()
+	defer resetSources()
+
+	tests := []struct {
+		in    string
+		srcIP string
+		want  float64
+	}{
+		// The first matching source decides, and sources without a time zone use the default
+		{"<34>Oct 11 2023 22:14:15 host1 app: text", "10.1.2.3", 1697055255},
+		{"<34>Oct 11 2023 22:14:15 host1 app: text", "10.2.0.5", 1697076855},
+		{"<34>Oct 11 2023 22:14:15 host1 app: text", "10.2.0.6", 1697062455},
+		{"<34>Oct 11 2023 22:14:15 host1 app: text", "192.168.1.1", 1697076855},
+
+		// Timestamps with a zone are not changed
+		{"<34>2023-10-11T22:14:15.250+00:00 host1 app: text", "10.1.2.3", 1697062455.25},
+		{"<189>12: router1: Oct 11 2023 22:14:15 UTC: %SYS-5-CONFIG_I: Configured", "10.1.2.3", 1697062455},
+
+		// ISO timestamps without a zone are in the sender's zone
+		{"<34>2023-10-11 22:14:15 host1 app: text", "10.1.2.3", 1697055255},
+	}
+	for _, tt := range tests {
+		g := parse.GELFMessage{}
+		if err := parseSyslog([]byte(tt.in), tt.srcIP, g); err != nil {
+			t.Errorf("parseSyslog(%q): %s", tt.in, err)
+			continue
+		}
+		if g["timestamp"] != tt.want {
+			t.Errorf("parseSyslog(%q) from %s timestamp = %v, want %v", tt.in, tt.srcIP, g["timestamp"], tt.want)
+		}
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.SyslogTimeWindow = 240
+
+	now := global.TimeStamp()
+	tests := []struct {
+		policy string
+		ts     float64
+		want   float64 // expected timestamp, 0 for about now
+		moved  bool    // _original_timestamp is added
+	}{
+		{"replace", now - 60, now - 60, false},
+		{"replace", now - 3600, 0, true},
+		{"keep", now - 3600, now - 3600, false},
+		{"clamp", now + 3600, now + 240, true},
+		{"clamp", now - 3600, now - 240, true},
+	}
+	for _, tt := range tests {
+		config.Config.SyslogTimePolicy = tt.policy
+		g := parse.GELFMessage{"timestamp": tt.ts}
+		checkTimestamp(g, tt.ts)
+
+		got := g["timestamp"].(float64)
+		want := tt.want
+		if want == 0 {
+			want = now
+		}
+		if got < want-5 || got > want+5 {
+			t.Errorf("%s %s: timestamp = %f, want %f", tt.policy, strconv.FormatFloat(tt.ts-now, 'f', 0, 64), got, want)
+		}
+		if _, ok := g["_original_timestamp"]; ok != tt.moved {
+			t.Errorf("%s %s: _original_timestamp added = %v", tt.policy, strconv.FormatFloat(tt.ts-now, 'f', 0, 64), ok)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"log2sqs/config"
+	"log2sqs/global"
+	"log2sqs/parse"
+)
+
+// Matches the PRI at the start of a message, <34>
+var priRegex = regexp.MustCompile(`^\s*<(\d{1,3})>`)
+
+// Matches a Cisco sequence number, 123:
+var seqRegex = regexp.MustCompile(`^(\d+):\s+`)
+
+// Matches the version of an RFC5424 message
+var versionRegex = regexp.MustCompile(`^1\s+`)
+
+// Matches a hostname before the timestamp, such as the Cisco origin-id, router1:
+var hostPrefixRegex = regexp.MustCompile(`^([\w.-]+):\s+`)
+
+// Matches an ISO 8601 timestamp, 2023-10-11T22:14:15.123+02:00
+var isoRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?)(Z|[+-]\d{2}:?\d{2})?:?(?:\s+|$)`)
+
+// Matches a BSD timestamp with an optional year, fractional seconds and Cisco time zone, such as
+// Oct 11 22:14:15, Oct 11 2023 22:14:15, *Mar  1 18:46:11.123: or Mar  1 2023 18:46:11 UTC:
+// Cisco prefixes timestamps with * or . when the clock is not synchronized.
+var bsdRegex = regexp.MustCompile(`^[*.]?([A-Z][a-z]{2}\s+\d{1,2}(?:\s+\d{4})?\s+\d{2}:\d{2}:\d{2}(?:\.\d+)?)(?:\s+(\d{4}))?(?:\s+([A-Z]{3,5}):|:)?(?:\s+|$)`)
+
+// Matches the tag and optional process ID, su[123]:, but not a Cisco mnemonic
+var tagRegex = regexp.MustCompile(`^([^\s:\[\]%][^\s:\[\]]*)(?:\[([^\]]*)\])?:(?:\s+|$)`)
+
+// Matches a Cisco %FACILITY-SEVERITY-MNEMONIC: or %FACILITY-SUBFACILITY-SEVERITY-MNEMONIC:
+var ciscoRegex = regexp.MustCompile(`^%([A-Z0-9_]+(?:-[A-Z0-9_]+)*)-([0-7])-([A-Z0-9_]+):\s*`)
+
+// Vendor decoders for the start of the message, tried in order. A decoder adds fields and
+// returns the rest of the message if it recognizes the message.
+var syslogDecoders = []func(g parse.GELFMessage, msg string) (string, bool){
+	ciscoDecoder,
+}
+
+// tolerant parses syslog messages that RFC3164 and RFC5424 parsers reject or misread, such as
+// messages without a hostname, timestamps with a year or fractional seconds, and Cisco messages
+// with sequence numbers. The PRI is required, and everything else is optional.
+func tolerant(buf []byte, srcIP string, g parse.GELFMessage) error {
+	s := strings.TrimRight(string(buf), "\r\n\x00")
+
+	m := priRegex.FindStringSubmatch(s)
+	if m == nil {
+		return errors.New("no PRI")
+	}
+	pri, _ := strconv.Atoi(m[1])
+	if pri > 191 {
+		return errors.New("invalid PRI")
+	}
+	s = s[len(m[0]):]
+
+	g["version"] = "1.1"
+	g["_via_hostname"] = config.Config.Hostname
+	g["_via_proto"] = "syslog_udp"
+	g["level"] = pri % 8
+	g["_facility"] = global.GetFacility(pri / 8)
+	g["_original_format"] = "RFC3164"
+
+	if v := versionRegex.FindString(s); v != "" {
+		g["_original_format"] = "RFC5424"
+		s = s[len(v):]
+	}
+
+	if m := seqRegex.FindStringSubmatch(s); m != nil {
+		g["_sequence"], _ = strconv.Atoi(m[1])
+		s = s[len(m[0]):]
+	}
+
+	// Timestamp, which may be preceded by the hostname
+	loc := sourceLocation(srcIP)
+	host := ""
+	t, rest, ok := syslogTimestamp(s, loc)
+	if !ok {
+		if m := hostPrefixRegex.FindStringSubmatch(s); m != nil {
+			if t, rest, ok = syslogTimestamp(s[len(m[0]):], loc); ok {
+				host = m[1]
+			}
+		}
+	}
+
+	if ok {
+		s = rest
+
+		// The hostname follows the timestamp unless the next word is the tag or a Cisco mnemonic
+		if host == "" {
+			word, after, _ := strings.Cut(s, " ")
+			if word != "" && after != "" && !strings.HasPrefix(word, "%") && !strings.HasSuffix(word, ":") && !strings.Contains(word, "[") {
+				host = word
+				s = strings.TrimLeft(after, " ")
+			}
+		}
+	}
+
+	// Cisco ASA separates the hostname from the message with a colon
+	s = strings.TrimPrefix(s, ": ")
+
+	if g["_original_format"] == "RFC5424" {
+		s = syslog5424Header(g, s)
+	} else if m := tagRegex.FindStringSubmatch(s); m != nil {
+		g["_app_name"] = m[1]
+		if m[2] != "" {
+			g["_proc_id"] = m[2]
+		}
+		s = s[len(m[0]):]
+	}
+
+	for _, decoder := range syslogDecoders {
+		if tmp, ok := decoder(g, s); ok {
+			s = tmp
+			break
+		}
+	}
+
+	// Messages without a hostname came from the sender
+	if host == "" || host == "-" {
+		host = srcIP
+	}
+	g["host"] = host
+	g["short_message"] = emptyMessage(s)
+
+	if parse.ParseSecurityEvent(string(buf), g) && (g["_app_name"] == "CEF" || g["_app_name"] == "LEEF") {
+		delete(g, "_app_name")
+	}
+
+	if config.Config.SyslogOverrideTime || !ok {
+		g["timestamp"] = global.TimeStamp()
+	} else {
+		ts := global.UnixTime(t)
+		g["timestamp"] = ts
+		checkTimestamp(g, ts)
+	}
+
+	if config.Config.SyslogFullMessage {
+		g["full_message"] = strings.TrimSuffix(string(buf), "\n")
+	}
+	return nil
+}
+
+// syslogTimestamp parses the timestamp at the start of s and returns the rest of s. Timestamps
+// without a time zone are in loc, and those without a year are in the last 12 months.
+func syslogTimestamp(s string, loc *time.Location) (time.Time, string, bool) {
+	if m := isoRegex.FindStringSubmatch(s); m != nil {
+		value := strings.Replace(m[1], " ", "T", 1)
+		var t time.Time
+		var err error
+		if m[2] != "" {
+			t, err = time.Parse("2006-01-02T15:04:05Z07:00", value+normalizeOffset(m[2]))
+		} else {
+			t, err = time.ParseInLocation("2006-01-02T15:04:05", value, loc)
+		}
+		if err == nil {
+			return t, s[len(m[0]):], true
+		}
+	}
+
+	if m := bsdRegex.FindStringSubmatch(s); m != nil {
+		fields := strings.Fields(m[1])
+		if m[2] != "" {
+			fields = append(fields[:2], m[2], fields[2])
+		}
+		if m[3] == "UTC" || m[3] == "GMT" {
+			loc = time.UTC
+		}
+
+		layout := "Jan 2 15:04:05"
+		if len(fields) == 4 {
+			layout = "Jan 2 2006 15:04:05"
+		}
+		t, err := time.ParseInLocation(layout, strings.Join(fields, " "), loc)
+		if err == nil {
+			if t.Year() == 0 {
+				t = t.AddDate(time.Now().In(loc).Year(), 0, 0)
+				if t.After(time.Now().Add(24 * time.Hour)) {
+					t = t.AddDate(-1, 0, 0)
+				}
+			}
+			return t, s[len(m[0]):], true
+		}
+	}
+	return time.Time{}, s, false
+}
+
+// normalizeOffset converts a time zone offset such as +0200 to +02:00
+func normalizeOffset(offset string) string {
+	if len(offset) == 5 {
+		return offset[:3] + ":" + offset[3:]
+	}
+	return offset
+}
+
+// syslog5424Header reads the HOSTNAME, APP-NAME, PROCID, MSGID and STRUCTURED-DATA that follow
+// the timestamp of an RFC5424 message and returns the message
+func syslog5424Header(g parse.GELFMessage, s string) string {
+	names := []string{"_app_name", "_proc_id", "_msg_id"}
+	for _, name := range names {
+		word, rest, _ := strings.Cut(s, " ")
+		if word != "-" {
+			g[name] = word
+		}
+		s = rest
+	}
+
+	if s == "" || s[0] == '-' {
+		return strings.TrimPrefix(strings.TrimPrefix(s, "-"), " ")
+	}
+
+	// Structured data ends at the first unescaped ] that is not followed by [
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == ']' && (i+1 == len(s) || s[i+1] != '['):
+			addStructuredData(g, s[:i+1])
+			return strings.TrimPrefix(s[i+1:], " ")
+		}
+	}
+	return s
+}
+
+// ciscoDecoder adds the facility, severity and mnemonic of a Cisco IOS or ASA message, such as
+// %LINK-3-UPDOWN: or %ASA-6-302013:, and uses the severity as the level
+func ciscoDecoder(g parse.GELFMessage, msg string) (string, bool) {
+	m := ciscoRegex.FindStringSubmatch(msg)
+	if m == nil {
+		return msg, false
+	}
+
+	severity, _ := strconv.Atoi(m[2])
+	g["_cisco_facility"] = m[1]
+	g["_cisco_severity"] = severity
+	g["_cisco_mnemonic"] = m[3]
+	g["level"] = severity
+	if _, ok := g["_app_name"]; !ok {
+		g["_app_name"] = m[1]
+	}
+	return msg[len(m[0]):], true
+}
+
+// emptyMessage returns the message or "-" if it is empty
+func emptyMessage(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "-"
+	}
+	return s
+}
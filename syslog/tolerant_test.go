@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2021-2023 Tenebris Technologies Inc.
+//
+
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"log2sqs/config"
+	"log2sqs/parse"
+)
+
+func TestTolerant(t *testing.T) {
+	config.Config = config.Data{}
+	config.SetDefaults()
+	config.Config.SyslogTimeWindow = 0
+	resetSources()
+
+	tests := []struct {
+		in     string
+		fields map[string]string // expected fields, "<none>" for a field that is not added
+	}{
+		{`<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`,
+			map[string]string{
+				"_original_format": "RFC3164",
+				"host":             "mymachine",
+				"level":            "2",
+				"_facility":        "auth",
+				"_app_name":        "su",
+				"_proc_id":         "<none>",
+				"short_message":    "'su root' failed for lonvick on /dev/pts/8",
+			}},
+		// No hostname, so the sender is the host
+		{`<38>Oct  1 22:14:15 sshd[812]: Accepted publickey for root from 203.0.113.9 port 51234 ssh2`,
+			map[string]string{"host": "10.0.0.1", "_app_name": "sshd", "_proc_id": "812", "level": "6"}},
+		// A year and microseconds in the timestamp
+		{`<30>Oct 11 2023 22:14:15.123456 web1 nginx: started`,
+			map[string]string{"host": "web1", "_app_name": "nginx", "timestamp": "1697062455.123456", "short_message": "started"}},
+		{`<14>2023-10-11T22:14:15.5+0200 web1 app[7]: ISO timestamp`,
+			map[string]string{"host": "web1", "_proc_id": "7", "timestamp": "1697055255.5"}},
+		// Cisco IOS with a sequence number, origin hostname and unsynchronized clock
+		{`<189>38: router1: *Mar  1 2023 18:46:11.123 UTC: %LINK-3-UPDOWN: Interface GigabitEthernet0/1, changed state to down`,
+			map[string]string{
+				"_sequence":       "38",
+				"host":            "router1",
+				"timestamp":       "1677696371.123",
+				"_cisco_facility": "LINK",
+				"_cisco_severity": "3",
+				"_cisco_mnemonic": "UPDOWN",
+				"level":           "3",
+				"_app_name":       "LINK",
+				"short_message":   "Interface GigabitEthernet0/1, changed state to down",
+			}},
+		// Cisco ASA, with and without a hostname
+		{`<166>Oct 11 2023 22:14:15: %ASA-6-302013: Built inbound TCP connection 7 for outside:203.0.113.9/51234 to inside:10.0.0.5/443`,
+			map[string]string{"host": "10.0.0.1", "_cisco_facility": "ASA", "_cisco_mnemonic": "302013", "level": "6", "timestamp": "1697062455"}},
+		{`<166>Oct 11 2023 22:14:15 fw1 : %ASA-4-106023: Deny tcp src outside:203.0.113.9/51234 dst inside:10.0.0.5/22`,
+			map[string]string{"host": "fw1", "_cisco_severity": "4", "short_message": "Deny tcp src outside:203.0.113.9/51234 dst inside:10.0.0.5/22"}},
+		// CEF events keep the CEF fields
+		{`<134>Oct 11 22:14:15 fw1 CEF:0|Vendor|Firewall|1.0|100|Connection blocked|5|src=203.0.113.9 dpt=22`,
+			map[string]string{"host": "fw1", "_event_format": "CEF", "short_message": "Connection blocked", "_src": "203.0.113.9", "_app_name": "<none>"}},
+		// RFC5424 messages, with an escaped bracket in the structured data
+		{`<165>1 2023-10-11T22:14:15.000001+00:00 host1 app 42 ID7 [meta sequenceId="9" note="a \] b"] message after SD`,
+			map[string]string{
+				"_original_format":    "RFC5424",
+				"host":                "host1",
+				"_app_name":           "app",
+				"_proc_id":            "42",
+				"_msg_id":             "ID7",
+				"_sd_meta_sequenceId": "9",
+				"_sd_meta_note":       "a ] b",
+				"timestamp":           "1697062455.000001",
+				"short_message":       "message after SD",
+			}},
+		// Truncated messages keep what there is
+		{`<34>Oct 11 22:1`, map[string]string{"host": "10.0.0.1", "short_message": "Oct 11 22:1"}},
+		{`<34>Oct 11 22:14:15`, map[string]string{"host": "10.0.0.1", "short_message": "-", "timestamp": "<any>"}},
+		{`<34>`, map[string]string{"host": "10.0.0.1", "short_message": "-", "level": "2"}},
+	}
+	for _, tt := range tests {
+		g := parse.GELFMessage{}
+		if err := tolerant([]byte(tt.in), "10.0.0.1", g); err != nil {
+			t.Errorf("tolerant(%q): %s", tt.in, err)
+			continue
+		}
+		for k, want := range tt.fields {
+			v, ok := g[k]
+			switch {
+			case want == "<none>":
+				if ok {
+					t.Errorf("tolerant(%q)[%s] = %v, want no field", tt.in, k, v)
+				}
+			case want == "<any>":
+				if !ok {
+					t.Errorf("tolerant(%q)[%s] missing", tt.in, k)
+				}
+			default:
+				got := fmt.Sprint(v)
+				if f, isFloat := v.(float64); isFloat {
+					got = strconv.FormatFloat(f, 'f', -1, 64)
+				}
+				if got != want {
+					t.Errorf("tolerant(%q)[%s] = %s, want %s", tt.in, k, got, want)
+				}
+			}
+		}
+	}
+
+	// Messages without a valid PRI are left to the plain text parser
+	for _, in := range []string{"Oct 11 22:14:15 host app: no PRI", "<192>too big", "<x>bad"} {
+		if err := tolerant([]byte(in), "10.0.0.1", parse.GELFMessage{}); err == nil {
+			t.Errorf("tolerant(%q) succeeded", in)
+		}
+	}
+}
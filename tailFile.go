@@ -6,6 +6,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"strings"
@@ -17,20 +18,35 @@ import (
 	"log2sqs/event"
 	"log2sqs/global"
 	"log2sqs/parse"
+	"log2sqs/process"
 )
 
 // Tail the file and write to the queue
 func tailFile(f config.InputFileDef) {
+	minDelay := time.Duration(config.Config.RetryMinDelay) * time.Second
+	maxDelay := time.Duration(config.Config.RetryMaxDelay) * time.Second
+	tailBackoff := global.NewBackoff(minDelay, maxDelay)
+	sendBackoff := global.NewBackoff(minDelay, maxDelay)
 
 	// Infinite loop to facilitate restart on error
 	for {
-		// Instantiate a parser of the given type
-		parser, err := parse.New(f.Type)
+		// Instantiate a parser of the given type, with any fallback types
+		parser, err := parse.NewChain(f.Type, f.Fallback)
 		if err != nil {
 			log.Printf("error initializing parser: %s", err.Error())
 			break
 		}
 
+		// Dates without a time zone are in the time zone of the input
+		if f.Timezone != "" {
+			loc, err := time.LoadLocation(f.Timezone)
+			if err != nil {
+				log.Printf("error loading time zone: %s", err.Error())
+				break
+			}
+			parser.SetLocation(loc)
+		}
+
 		// Determine where we should start reading. By default, always start at the end to avoid
 		// reprocessing old data. But, if ReadAll is set, start at the beginning.
 		whence := io.SeekEnd
@@ -42,67 +58,125 @@ func tailFile(f config.InputFileDef) {
 		// Tail the file
 		t, err := tail.TailFile(f.Name, tail.Config{Follow: true, ReOpen: true, Location: &tail.SeekInfo{Offset: 0, Whence: whence}})
 		if err != nil {
+			wait := tailBackoff.Next()
 			log.Printf("Error tailing file: %s [%s %s]", err.Error(), f.Name, f.Type)
-			log.Printf("Sleeping for 60 seconds...")
-			time.Sleep(60 * time.Second)
+			log.Printf("Sleeping for %s...", wait.Round(time.Second))
+			time.Sleep(wait)
+			continue
 		}
 
-		// Loop and read
-		for line := range t.Lines {
-
-			// Trim leading and trailing whitespace and parse the line
-			s := strings.TrimSpace(line.Text)
-			g, err2 := parser.Parse(s)
-			if err2 != nil {
-				log.Printf("error parsing %s: %s", s, err2.Error())
-			} else {
-				// Add filename
-				g["_log_file"] = f.Name
-				g["_log_source"] = config.Config.Hostname
-
-				// Do we have addFields to add?
-				for key, value := range config.Config.AddFields {
-					g[key] = value
+		// Loop and read. Check periodically for events that span several lines, such as
+		// auditd events, that have not been completed.
+		flush := time.NewTicker(time.Second)
+		flushTimeout := time.Duration(config.Config.AuditdFlushTimeout) * time.Second
+
+	read:
+		for {
+			select {
+			case line, ok := <-t.Lines:
+				if !ok {
+					break read
 				}
 
-				// Marshal JSON for queue
-				gBytes, err := json.Marshal(g)
-				if err != nil {
-					log.Printf("Failed to marshal JSON %s [%s %s]", err.Error(), f.Name, f.Type)
-					// Drop this log event
+				// Trim leading and trailing whitespace and parse the line
+				s := strings.TrimSpace(line.Text)
+				g, err2 := parser.Parse(s)
+				if errors.Is(err2, parse.ErrSkip) {
+					// Header lines and incomplete events
 					continue
 				}
-
-				// For debugging only
-				if config.Config.Debug || dryRun {
-					global.JSONPretty(gBytes)
+				if err2 != nil {
+					log.Printf("error parsing %s: %s", process.Redact(s), err2.Error())
+					event.DeadLetterRaw(f.Name, parser.Format(), s, err2)
+					continue
 				}
+				sendFileEvent(g, f, sendBackoff)
 
-				if !dryRun {
-					// Loop until line is sent to allow retries in the event of a failure
-					// Since these are log files, there is no need to buffer them in memory
-					sent := false
-					for sent == false {
-						err := event.Send(gBytes)
-						if err != nil {
-							// Log error
-							log.Printf("Error sending to queue: %s [%s %s]", err.Error(), f.Name, f.Type)
-							log.Printf("Sleeping for 30 seconds...")
-							time.Sleep(30 * time.Second)
-						} else {
-							sent = true
-						}
+			case <-flush.C:
+				for {
+					g, ok := parser.Flush(flushTimeout)
+					if !ok {
+						break
 					}
+					sendFileEvent(g, f, sendBackoff)
 				}
 			}
 		}
+		flush.Stop()
+
+		// Send any incomplete events
+		for {
+			g, ok := parser.Flush(0)
+			if !ok {
+				break
+			}
+			sendFileEvent(g, f, sendBackoff)
+		}
 
 		// For loop fell through. If there is an error, wait and restart the tail.
 		err = t.Wait()
 		if err != nil {
+			wait := tailBackoff.Next()
 			log.Printf("Wait error: %s [%s %s]", err.Error(), f.Name, f.Type)
-			log.Printf("Sleeping for 60 seconds...")
-			time.Sleep(60 * time.Second)
+			log.Printf("Sleeping for %s...", wait.Round(time.Second))
+			time.Sleep(wait)
+		} else {
+			tailBackoff.Reset()
 		}
 	}
 }
+
+// sendFileEvent sends a parsed line, retrying until it is sent
+func sendFileEvent(g parse.GELFMessage, f config.InputFileDef, sendBackoff *global.Backoff) {
+
+	// Add file information and marshal JSON for queue
+	gBytes, err := fileEvent(g, f.Name)
+	if errors.Is(err, process.ErrFiltered) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to marshal JSON %s [%s %s]", err.Error(), f.Name, f.Type)
+		// Drop this log event
+		return
+	}
+
+	// For debugging only
+	if config.Config.Debug || dryRun {
+		global.JSONPretty(gBytes)
+	}
+
+	if dryRun {
+		return
+	}
+
+	// Loop until line is sent to allow retries in the event of a failure
+	// Since these are log files, there is no need to buffer them in memory
+	// Events that can never be sent are dead-lettered by event.Send
+	for {
+		err := event.Send(gBytes)
+		if err == nil {
+			sendBackoff.Reset()
+			return
+		}
+
+		// Log error, and wait as long as the output asked if it did
+		wait := event.RetryDelay(err)
+		if wait > 0 {
+			wait = sendBackoff.Limit(wait)
+		} else {
+			wait = sendBackoff.Next()
+		}
+		log.Printf("Error sending to queue: %s [%s %s]", err.Error(), f.Name, f.Type)
+		log.Printf("Sleeping for %s...", wait.Round(time.Second))
+		time.Sleep(wait)
+	}
+}
+
+// fileEvent adds the file name, source and static fields to a parsed line, applies the
+// processors and filters and returns the JSON, or process.ErrFiltered if it is discarded
+func fileEvent(g parse.GELFMessage, name string) ([]byte, error) {
+	if !process.Apply(g, process.Input{File: name}) {
+		return nil, process.ErrFiltered
+	}
+	return json.Marshal(g)
+}